@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- AUTENTICACIÓN (Firebase ID Tokens) ---
+
+// JWKS público de Google para los tokens emitidos por Firebase Auth
+const firebaseJWKSURL = "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
+
+// Claves del contexto de Gin donde dejamos la identidad verificada
+const (
+	ctxUserID    = "auth_uid"
+	ctxUserEmail = "auth_email"
+)
+
+var (
+	errTokenMalformed = errors.New("token mal formado")
+	errTokenSignature = errors.New("firma inválida")
+	errTokenExpired   = errors.New("token expirado")
+	errTokenClaims    = errors.New("claims inválidos")
+	errKeyNotFound    = errors.New("clave pública no encontrada")
+)
+
+// KeySource entrega la clave pública RSA asociada a un 'kid'.
+// En producción es el JWKS de Google; en pruebas puede ser un par de claves local.
+type KeySource interface {
+	PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error)
+}
+
+// StaticKeySource es un KeySource fijo en memoria (útil para pruebas y entornos locales)
+type StaticKeySource map[string]*rsa.PublicKey
+
+func (s StaticKeySource) PublicKey(_ context.Context, kid string) (*rsa.PublicKey, error) {
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	return nil, errKeyNotFound
+}
+
+// JWKSKeySource descarga y cachea un JWKS remoto respetando Cache-Control: max-age
+type JWKSKeySource struct {
+	URL    string
+	Client *http.Client
+
+	mu      sync.RWMutex
+	keys    map[string]*rsa.PublicKey
+	expires time.Time
+}
+
+func NewJWKSKeySource(url string) *JWKSKeySource {
+	return &JWKSKeySource{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *JWKSKeySource) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	fresh := time.Now().Before(s.expires)
+	s.mu.RUnlock()
+	if ok && fresh {
+		return key, nil
+	}
+
+	// Clave desconocida o cache vencida: refrescamos (Google rota las claves a diario)
+	if err := s.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errKeyNotFound
+}
+
+func (s *JWKSKeySource) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("descargando JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("descargando JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decodificando JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.expires = time.Now().Add(cacheMaxAge(resp.Header.Get("Cache-Control"), time.Hour))
+	s.mu.Unlock()
+	return nil
+}
+
+// cacheMaxAge extrae max-age de un header Cache-Control (o usa el valor por defecto)
+func cacheMaxAge(header string, def time.Duration) time.Duration {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "max-age=") {
+			if secs, err := strconv.Atoi(strings.TrimPrefix(part, "max-age=")); err == nil && secs > 0 {
+				return time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return def
+}
+
+// FirebaseToken es la identidad extraída de un ID token ya verificado
+type FirebaseToken struct {
+	UID       string
+	Email     string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// FirebaseVerifier valida ID tokens de Firebase (RS256) para un proyecto concreto
+type FirebaseVerifier struct {
+	ProjectID string
+	Keys      KeySource
+	Now       func() time.Time // Inyectable para pruebas
+	Leeway    time.Duration    // Tolerancia de reloj
+}
+
+func NewFirebaseVerifier(projectID string, keys KeySource) *FirebaseVerifier {
+	return &FirebaseVerifier{ProjectID: projectID, Keys: keys, Now: time.Now, Leeway: time.Minute}
+}
+
+func (v *FirebaseVerifier) Verify(ctx context.Context, raw string) (*FirebaseToken, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errTokenMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errTokenMalformed
+	}
+	if header.Alg != "RS256" || header.Kid == "" {
+		return nil, errTokenMalformed
+	}
+
+	key, err := v.Keys.PublicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errTokenMalformed
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, errTokenSignature
+	}
+
+	var claims struct {
+		Iss      string `json:"iss"`
+		Aud      string `json:"aud"`
+		Sub      string `json:"sub"`
+		Email    string `json:"email"`
+		Iat      int64  `json:"iat"`
+		Exp      int64  `json:"exp"`
+		AuthTime int64  `json:"auth_time"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errTokenMalformed
+	}
+
+	// Reglas de Firebase: https://firebase.google.com/docs/auth/admin/verify-id-tokens
+	now := v.Now()
+	if claims.Aud != v.ProjectID || claims.Iss != "https://securetoken.google.com/"+v.ProjectID {
+		return nil, errTokenClaims
+	}
+	if claims.Sub == "" || len(claims.Sub) > 128 {
+		return nil, errTokenClaims
+	}
+	if time.Unix(claims.Iat, 0).After(now.Add(v.Leeway)) || time.Unix(claims.AuthTime, 0).After(now.Add(v.Leeway)) {
+		return nil, errTokenClaims
+	}
+	if !time.Unix(claims.Exp, 0).After(now.Add(-v.Leeway)) {
+		return nil, errTokenExpired
+	}
+
+	return &FirebaseToken{
+		UID:       claims.Sub,
+		Email:     claims.Email,
+		IssuedAt:  time.Unix(claims.Iat, 0),
+		ExpiresAt: time.Unix(claims.Exp, 0),
+	}, nil
+}
+
+func decodeSegment(seg string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// --- MIDDLEWARE ---
+
+// AuthRequired exige un 'Authorization: Bearer <ID token>' válido y deja el UID en el contexto
+func AuthRequired(v *FirebaseVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		raw, found := strings.CutPrefix(header, "Bearer ")
+		if !found || strings.TrimSpace(raw) == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Falta token de autenticación"})
+			return
+		}
+
+		token, err := v.Verify(c.Request.Context(), strings.TrimSpace(raw))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token inválido: " + err.Error()})
+			return
+		}
+
+		c.Set(ctxUserID, token.UID)
+		c.Set(ctxUserEmail, token.Email)
+		c.Next()
+	}
+}
+
+// currentUserID devuelve el UID verificado por AuthRequired
+func currentUserID(c *gin.Context) string {
+	return c.GetString(ctxUserID)
+}
+
+// requireSelf valida que el :user_id de la ruta (si viene) sea el del token.
+// Devuelve el UID verificado o aborta con 403.
+func requireSelf(c *gin.Context) (string, bool) {
+	uid := currentUserID(c)
+	if param := c.Param("user_id"); param != "" && param != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No puedes consultar datos de otro usuario"})
+		return "", false
+	}
+	return uid, true
+}
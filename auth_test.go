@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testProjectID = "zonaflash-test"
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generando clave RSA: %v", err)
+	}
+	return key
+}
+
+func testClaims(uid string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":       "https://securetoken.google.com/" + testProjectID,
+		"aud":       testProjectID,
+		"sub":       uid,
+		"email":     uid + "@example.com",
+		"iat":       testNow.Add(-time.Minute).Unix(),
+		"auth_time": testNow.Add(-time.Minute).Unix(),
+		"exp":       testNow.Add(time.Hour).Unix(),
+	}
+}
+
+// signTestToken firma un JWT RS256 con la clave local, igual que lo haría Firebase
+func signTestToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	enc := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("serializando segmento: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := enc(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("firmando token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newTestVerifier(keys StaticKeySource) *FirebaseVerifier {
+	v := NewFirebaseVerifier(testProjectID, keys)
+	v.Now = func() time.Time { return testNow }
+	return v
+}
+
+func TestVerifyValidToken(t *testing.T) {
+	key := newTestKey(t)
+	v := newTestVerifier(StaticKeySource{"k1": &key.PublicKey})
+
+	tok, err := v.Verify(context.Background(), signTestToken(t, key, "k1", testClaims("uid-123")))
+	if err != nil {
+		t.Fatalf("token válido rechazado: %v", err)
+	}
+	if tok.UID != "uid-123" || tok.Email != "uid-123@example.com" {
+		t.Fatalf("identidad inesperada: %+v", tok)
+	}
+}
+
+func TestVerifyExpiredToken(t *testing.T) {
+	key := newTestKey(t)
+	v := newTestVerifier(StaticKeySource{"k1": &key.PublicKey})
+
+	claims := testClaims("uid-123")
+	claims["iat"] = testNow.Add(-3 * time.Hour).Unix()
+	claims["auth_time"] = testNow.Add(-3 * time.Hour).Unix()
+	claims["exp"] = testNow.Add(-2 * time.Hour).Unix()
+
+	if _, err := v.Verify(context.Background(), signTestToken(t, key, "k1", claims)); !errors.Is(err, errTokenExpired) {
+		t.Fatalf("esperaba errTokenExpired, obtuve %v", err)
+	}
+}
+
+func TestVerifyWrongAudienceOrIssuer(t *testing.T) {
+	key := newTestKey(t)
+	v := newTestVerifier(StaticKeySource{"k1": &key.PublicKey})
+
+	cases := map[string]func(map[string]interface{}){
+		"aud": func(c map[string]interface{}) { c["aud"] = "otro-proyecto" },
+		"iss": func(c map[string]interface{}) { c["iss"] = "https://securetoken.google.com/otro-proyecto" },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := testClaims("uid-123")
+			mutate(claims)
+			if _, err := v.Verify(context.Background(), signTestToken(t, key, "k1", claims)); !errors.Is(err, errTokenClaims) {
+				t.Fatalf("esperaba errTokenClaims, obtuve %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyBadSignature(t *testing.T) {
+	key := newTestKey(t)
+	attacker := newTestKey(t)
+	v := newTestVerifier(StaticKeySource{"k1": &key.PublicKey})
+
+	// Mismo kid, pero firmado con otra clave
+	raw := signTestToken(t, attacker, "k1", testClaims("uid-123"))
+	if _, err := v.Verify(context.Background(), raw); !errors.Is(err, errTokenSignature) {
+		t.Fatalf("esperaba errTokenSignature, obtuve %v", err)
+	}
+}
+
+func TestVerifyKidRotation(t *testing.T) {
+	oldKey := newTestKey(t)
+	newKey := newTestKey(t)
+	keys := StaticKeySource{"old": &oldKey.PublicKey}
+	v := newTestVerifier(keys)
+
+	oldToken := signTestToken(t, oldKey, "old", testClaims("uid-123"))
+	newToken := signTestToken(t, newKey, "new", testClaims("uid-123"))
+
+	if _, err := v.Verify(context.Background(), oldToken); err != nil {
+		t.Fatalf("token con kid vigente rechazado: %v", err)
+	}
+	if _, err := v.Verify(context.Background(), newToken); !errors.Is(err, errKeyNotFound) {
+		t.Fatalf("kid desconocido: esperaba errKeyNotFound, obtuve %v", err)
+	}
+
+	// Google publica la nueva clave y retira la anterior
+	keys["new"] = &newKey.PublicKey
+	delete(keys, "old")
+
+	if _, err := v.Verify(context.Background(), newToken); err != nil {
+		t.Fatalf("token con kid rotado rechazado: %v", err)
+	}
+	if _, err := v.Verify(context.Background(), oldToken); !errors.Is(err, errKeyNotFound) {
+		t.Fatalf("kid retirado: esperaba errKeyNotFound, obtuve %v", err)
+	}
+}
+
+func TestRequireSelfForbidsOtherUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	key := newTestKey(t)
+	v := newTestVerifier(StaticKeySource{"k1": &key.PublicKey})
+
+	r := gin.New()
+	r.GET("/users/:user_id", AuthRequired(v), func(c *gin.Context) {
+		uid, ok := requireSelf(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"uid": uid})
+	})
+
+	token := signTestToken(t, key, "k1", testClaims("uid-123"))
+	cases := []struct {
+		path string
+		auth string
+		want int
+	}{
+		{"/users/uid-123", "Bearer " + token, http.StatusOK},
+		{"/users/uid-456", "Bearer " + token, http.StatusForbidden},
+		{"/users/uid-123", "", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s (auth=%t): status %d, esperaba %d", tc.path, tc.auth != "", w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport"
+)
+
+// --- ALMACENAMIENTO DE ARCHIVOS (Fotos de capturas) ---
+
+// BlobStore guarda objetos y devuelve su URL pública
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error)
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+var errBlobNotFound = errors.New("objeto no encontrado")
+
+// BlobConfig selección de backend (BLOB_BACKEND = gcs | local | memory)
+type BlobConfig struct {
+	Backend         string
+	GCSBucket       string // GCS_BUCKET
+	GCSCredentials  string // GCS_CREDENTIALS_FILE (vacío = credenciales por defecto del entorno)
+	LocalDir        string // LOCAL_BLOB_DIR
+	LocalPublicBase string // LOCAL_BLOB_PUBLIC_URL: prefijo que apunta a la ruta /media del servidor
+}
+
+func blobConfigFromEnv() BlobConfig {
+	cfg := BlobConfig{
+		Backend:         os.Getenv("BLOB_BACKEND"),
+		GCSBucket:       os.Getenv("GCS_BUCKET"),
+		GCSCredentials:  os.Getenv("GCS_CREDENTIALS_FILE"),
+		LocalDir:        os.Getenv("LOCAL_BLOB_DIR"),
+		LocalPublicBase: os.Getenv("LOCAL_BLOB_PUBLIC_URL"),
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = "gcs"
+	}
+	if cfg.LocalDir == "" {
+		cfg.LocalDir = "./data/blobs"
+	}
+	if cfg.LocalPublicBase == "" {
+		cfg.LocalPublicBase = "/media"
+	}
+	return cfg
+}
+
+// newBlobStore crea el backend una sola vez al arrancar
+func newBlobStore(ctx context.Context, cfg BlobConfig) (BlobStore, error) {
+	switch cfg.Backend {
+	case "gcs":
+		if cfg.GCSBucket == "" {
+			return nil, errors.New("BLOB_BACKEND=gcs requiere GCS_BUCKET")
+		}
+		return newGCSStore(ctx, cfg.GCSBucket, cfg.GCSCredentials)
+	case "local":
+		return newLocalStore(cfg.LocalDir, cfg.LocalPublicBase)
+	case "memory":
+		return newMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("BLOB_BACKEND desconocido: %s", cfg.Backend)
+}
+
+// --- GCS ---
+
+type gcsStore struct {
+	client *storage.Client
+	bucket string
+}
+
+func newGCSStore(ctx context.Context, bucket, credentialsFile string) (*gcsStore, error) {
+	var opts []option.ClientOption
+
+	// Secret File montado (Render): identidad aislada con transporte manual,
+	// así el SDK no intenta autenticarse por su cuenta con otras credenciales del entorno.
+	// Sin GCS_CREDENTIALS_FILE se usan las credenciales por defecto del entorno.
+	if credentialsFile != "" {
+		data, err := os.ReadFile(credentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("leyendo %s: %w", credentialsFile, err)
+		}
+		creds, err := google.CredentialsFromJSON(ctx, data, storage.ScopeFullControl)
+		if err != nil {
+			return nil, fmt.Errorf("procesando credenciales GCS: %w", err)
+		}
+		hc, _, err := transport.NewHTTPClient(ctx, option.WithCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("creando transporte HTTP: %w", err)
+		}
+		opts = append(opts, option.WithHTTPClient(hc), option.WithoutAuthentication())
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creando cliente GCS: %w", err)
+	}
+	return &gcsStore{client: client, bucket: bucket}, nil
+}
+
+func (s *gcsStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	wc := s.client.Bucket(s.bucket).Object(key).NewWriter(ctx)
+	wc.ContentType = contentType
+	if _, err := io.Copy(wc, r); err != nil {
+		wc.Close()
+		return "", fmt.Errorf("copiando a GCS: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return "", fmt.Errorf("cerrando GCS writer: %w", err)
+	}
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", s.bucket, key), nil
+}
+
+func (s *gcsStore) Delete(ctx context.Context, key string) error {
+	err := s.client.Bucket(s.bucket).Object(key).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return errBlobNotFound
+	}
+	return err
+}
+
+func (s *gcsStore) Close() error { return s.client.Close() }
+
+// --- DISCO LOCAL (desarrollo) ---
+
+type localStore struct {
+	dir        string
+	publicBase string
+}
+
+func newLocalStore(dir, publicBase string) (*localStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &localStore{dir: dir, publicBase: strings.TrimRight(publicBase, "/")}, nil
+}
+
+// path evita que una clave con '..' escape del directorio base
+func (s *localStore) path(key string) (string, error) {
+	p := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, filepath.Clean(s.dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("clave inválida: %s", key)
+	}
+	return p, nil
+}
+
+func (s *localStore) Put(_ context.Context, key string, r io.Reader, _ string) (string, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(p)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return s.publicBase + "/" + (&url.URL{Path: key}).EscapedPath(), nil
+}
+
+func (s *localStore) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return errBlobNotFound
+	}
+	return err
+}
+
+func (s *localStore) Close() error { return nil }
+
+// --- MEMORIA (pruebas) ---
+
+type memoryBlob struct {
+	Data        []byte
+	ContentType string
+}
+
+type memoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryBlob
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{objects: map[string]memoryBlob{}}
+}
+
+func (s *memoryStore) Put(_ context.Context, key string, r io.Reader, contentType string) (string, error) {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.objects[key] = memoryBlob{Data: buf.Bytes(), ContentType: contentType}
+	s.mu.Unlock()
+	return "mem://" + key, nil
+}
+
+func (s *memoryStore) Get(key string) (memoryBlob, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.objects[key]
+	return b, ok
+}
+
+func (s *memoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[key]; !ok {
+		return errBlobNotFound
+	}
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memoryStore) Close() error { return nil }
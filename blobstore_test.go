@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewBlobStoreRequiresGCSBucket(t *testing.T) {
+	_, err := newBlobStore(context.Background(), BlobConfig{Backend: "gcs"})
+	if err == nil || !strings.Contains(err.Error(), "GCS_BUCKET") {
+		t.Fatalf("esperaba error por GCS_BUCKET vacío, obtuve %v", err)
+	}
+}
+
+func TestNewBlobStoreUnknownBackend(t *testing.T) {
+	if _, err := newBlobStore(context.Background(), BlobConfig{Backend: "s3"}); err == nil {
+		t.Fatal("esperaba error por backend desconocido")
+	}
+}
+
+func TestMemoryStoreRoundTrip(t *testing.T) {
+	store, err := newBlobStore(context.Background(), BlobConfig{Backend: "memory"})
+	if err != nil {
+		t.Fatalf("creando store: %v", err)
+	}
+	mem := store.(*memoryStore)
+	ctx := context.Background()
+
+	url, err := mem.Put(ctx, "hunts/abc.jpg", strings.NewReader("jpeg"), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if url != "mem://hunts/abc.jpg" {
+		t.Fatalf("URL inesperada: %s", url)
+	}
+	blob, ok := mem.Get("hunts/abc.jpg")
+	if !ok || string(blob.Data) != "jpeg" || blob.ContentType != "image/jpeg" {
+		t.Fatalf("objeto inesperado: %+v (ok=%t)", blob, ok)
+	}
+
+	if err := mem.Delete(ctx, "hunts/abc.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := mem.Get("hunts/abc.jpg"); ok {
+		t.Fatal("el objeto sigue tras Delete")
+	}
+	if err := mem.Delete(ctx, "hunts/abc.jpg"); !errors.Is(err, errBlobNotFound) {
+		t.Fatalf("esperaba errBlobNotFound, obtuve %v", err)
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newLocalStore(dir, "/media/")
+	if err != nil {
+		t.Fatalf("creando store: %v", err)
+	}
+	ctx := context.Background()
+
+	url, err := store.Put(ctx, "hunts/a b.jpg", strings.NewReader("jpeg"), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if url != "/media/hunts/a%20b.jpg" {
+		t.Fatalf("URL inesperada: %s", url)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "hunts", "a b.jpg"))
+	if err != nil || string(data) != "jpeg" {
+		t.Fatalf("archivo inesperado: %q (%v)", data, err)
+	}
+
+	if err := store.Delete(ctx, "hunts/a b.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(ctx, "hunts/a b.jpg"); !errors.Is(err, errBlobNotFound) {
+		t.Fatalf("esperaba errBlobNotFound, obtuve %v", err)
+	}
+}
+
+func TestLocalStoreRejectsTraversal(t *testing.T) {
+	store, err := newLocalStore(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatalf("creando store: %v", err)
+	}
+	if _, err := store.Put(context.Background(), "../escape.jpg", strings.NewReader("x"), "image/jpeg"); err == nil {
+		t.Fatal("esperaba error por clave con '..'")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- BÚSQUEDA A LO LARGO DE UNA RUTA (Corredor) ---
+
+const (
+	corridorDefaultWidth = 500 // Metros a cada lado de la ruta
+	corridorMaxWidth     = 5000
+	corridorMaxPoints    = 5000
+	corridorMaxResults   = 200
+)
+
+// CorridorResult punto del mapa con su posición sobre la ruta
+type CorridorResult struct {
+	OfferResponse         // distance_meters = distancia a la ruta (desvío)
+	RouteFraction float64 `json:"route_fraction"` // 0 = origen, 1 = destino
+	AlongMeters   float64 `json:"along_meters"`   // Metros recorridos desde el origen hasta el punto más cercano
+}
+
+// decodePolyline decodifica el formato "encoded polyline" de Google (precisión 5) a [lng, lat]
+func decodePolyline(s string) ([][2]float64, error) {
+	var points [][2]float64
+	var lat, lng int
+	for i := 0; i < len(s); {
+		var deltas [2]int
+		for k := range deltas {
+			result, shift := 0, 0
+			for {
+				if i >= len(s) {
+					return nil, errors.New("polyline truncada")
+				}
+				b := int(s[i]) - 63
+				i++
+				if b < 0 || b > 63 {
+					return nil, errors.New("polyline con caracteres inválidos")
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+				if shift > 30 {
+					return nil, errors.New("polyline inválida")
+				}
+			}
+			if result&1 != 0 {
+				deltas[k] = ^(result >> 1)
+			} else {
+				deltas[k] = result >> 1
+			}
+		}
+		lat += deltas[0]
+		lng += deltas[1]
+		points = append(points, [2]float64{float64(lng) / 1e5, float64(lat) / 1e5})
+	}
+	return points, nil
+}
+
+// routeLineGeoJSON valida la ruta (polyline o LineString) y la devuelve como GeoJSON limpio
+func routeLineGeoJSON(polyline string, line json.RawMessage) (string, error) {
+	var coords [][2]float64
+	switch {
+	case polyline != "":
+		var err error
+		if coords, err = decodePolyline(polyline); err != nil {
+			return "", err
+		}
+	case len(line) > 0:
+		var geom struct {
+			Type        string       `json:"type"`
+			Coordinates [][2]float64 `json:"coordinates"`
+		}
+		if err := json.Unmarshal(line, &geom); err != nil || geom.Type != "LineString" {
+			return "", errors.New("line debe ser un GeoJSON de tipo LineString")
+		}
+		coords = geom.Coordinates
+	default:
+		return "", errors.New("Falta la ruta (polyline o line)")
+	}
+
+	if len(coords) < 2 {
+		return "", errors.New("la ruta necesita al menos 2 puntos")
+	}
+	if len(coords) > corridorMaxPoints {
+		return "", fmt.Errorf("la ruta admite hasta %d puntos", corridorMaxPoints)
+	}
+	for _, p := range coords {
+		if p[0] < -180 || p[0] > 180 || p[1] < -90 || p[1] > 90 {
+			return "", errBadCoords
+		}
+	}
+	clean, _ := json.Marshal(map[string]interface{}{"type": "LineString", "coordinates": coords})
+	return string(clean), nil
+}
+
+// searchCorridor: POST /api/route-search
+// Body: polyline (encoded) o line (GeoJSON LineString), width_m, categories (opcional), limit.
+func searchCorridor(c *gin.Context) {
+	var req struct {
+		Polyline   string          `json:"polyline"`
+		Line       json.RawMessage `json:"line"`
+		WidthM     float64         `json:"width_m"`
+		Categories []string        `json:"categories"`
+		Limit      int             `json:"limit"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	line, err := routeLineGeoJSON(req.Polyline, req.Line)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.WidthM == 0 {
+		req.WidthM = corridorDefaultWidth
+	}
+	if req.WidthM < 0 || req.WidthM > corridorMaxWidth {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("width_m debe estar entre 1 y %d", corridorMaxWidth)})
+		return
+	}
+	if req.Limit <= 0 || req.Limit > corridorMaxResults {
+		req.Limit = mapDefaultLimit
+	}
+
+	area := mapArea{
+		cond: "ST_DWithin({col}, ST_SetSRID(ST_GeomFromGeoJSON(?), 4326)::geography, ?)",
+		args: []interface{}{line, req.WidthM},
+	}
+	points, args := mapPointsSQL(area)
+	query := `
+		WITH route AS (SELECT ST_SetSRID(ST_GeomFromGeoJSON(?), 4326) AS line)
+		SELECT p.id, p.title, p.description, p.price, p.category, p.status, p.latitude, p.longitude,
+			ST_Distance(p.geog, route.line::geography) AS distance_meters,
+			p.remaining_seconds, p.remaining_stock,
+			ST_LineLocatePoint(route.line, p.geog::geometry) AS route_fraction,
+			ST_LineLocatePoint(route.line, p.geog::geometry) * ST_Length(route.line::geography) AS along_meters
+		FROM (` + points + `) p, route`
+	args = append([]interface{}{line}, args...)
+	if len(req.Categories) > 0 {
+		query += " WHERE p.category IN ?"
+		args = append(args, req.Categories)
+	}
+	// Orden del recorrido; a igual posición, el que menos desvío exige
+	query += " ORDER BY route_fraction ASC, distance_meters ASC LIMIT ?"
+	args = append(args, req.Limit)
+
+	results := []CorridorResult{}
+	if err := db.Raw(query, args...).Scan(&results).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error buscando en la ruta"})
+		return
+	}
+	c.JSON(200, results)
+}
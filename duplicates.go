@@ -0,0 +1,190 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// --- DETECCIÓN DE DUPLICADOS (Nombre + distancia + familia de categoría) ---
+
+// DuplicateConfig pesos y umbrales del puntaje de duplicado
+type DuplicateConfig struct {
+	RadiusM      float64 // Radio de búsqueda de candidatos
+	Threshold    float64 // Puntaje a partir del cual se pide confirmación
+	NameWeight   float64
+	DistWeight   float64
+	FamilyWeight float64
+}
+
+var duplicateConfig = DuplicateConfig{
+	RadiusM:      60,
+	Threshold:    0.65,
+	NameWeight:   0.55,
+	DistWeight:   0.25,
+	FamilyWeight: 0.20,
+}
+
+// categoryFamilies agrupa categorías que suelen describir el mismo negocio
+var categoryFamilies = map[string]string{
+	"station_moto": "fuel",
+	"station_car":  "fuel",
+	"fuel_dollar":  "fuel",
+	"mechanic":     "service",
+	"oil":          "service",
+	"tires":        "service",
+	"parts":        "parts",
+	"wash":         "wash",
+	"tow":          "tow",
+	"food":         "food",
+}
+
+func categoryFamily(category string) string {
+	if f, ok := categoryFamilies[category]; ok {
+		return f
+	}
+	return category
+}
+
+// Palabras que no distinguen un negocio de otro
+var shopStopwords = map[string]bool{
+	"el": true, "la": true, "los": true, "las": true, "de": true, "del": true, "y": true,
+	"ca": true, "sa": true, "srl": true,
+}
+
+// Sufijos societarios ("C.A.", "S.R.L."): se quitan antes de unir siglas
+var legalSuffix = regexp.MustCompile(`\b(c\.?\s?a|s\.?\s?a|s\.?\s?r\.?\s?l)\.?\s*$`)
+
+var accentFold = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+	"à", "a", "è", "e", "ì", "i", "ò", "o", "ù", "u",
+)
+
+// normalizeShopName minúsculas, sin acentos ni puntuación, sin palabras vacías
+func normalizeShopName(name string) string {
+	s := accentFold.Replace(strings.ToLower(strings.TrimSpace(name)))
+	s = legalSuffix.ReplaceAllString(s, "")
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, s)
+	// Siglas con puntos ("P.D.V.") quedan como letras sueltas: se vuelven a unir
+	var words []string
+	initials := ""
+	for _, w := range strings.Fields(s) {
+		if len([]rune(w)) == 1 {
+			initials += w
+			continue
+		}
+		if initials != "" {
+			words, initials = appendShopWord(words, initials), ""
+		}
+		words = appendShopWord(words, w)
+	}
+	if initials != "" {
+		words = appendShopWord(words, initials)
+	}
+	return strings.Join(words, " ")
+}
+
+func appendShopWord(words []string, w string) []string {
+	if shopStopwords[w] {
+		return words
+	}
+	return append(words, w)
+}
+
+// trigrams igual que pg_trgm: cada palabra con dos espacios delante y uno detrás
+func trigrams(s string) map[string]bool {
+	out := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			out[string(r[i:i+3])] = true
+		}
+	}
+	return out
+}
+
+// nameSimilarity similitud de trigramas (0..1) entre nombres normalizados
+func nameSimilarity(a, b string) float64 {
+	a, b = normalizeShopName(a), normalizeShopName(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	ta, tb := trigrams(a), trigrams(b)
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// DuplicateCandidate captura existente que podría ser el mismo negocio
+type DuplicateCandidate struct {
+	ID        string  `json:"id"`
+	ShopName  string  `json:"shop_name"`
+	Category  string  `json:"category"`
+	Status    string  `json:"status"`
+	DistanceM float64 `json:"distance_m"`
+	NameScore float64 `json:"name_score"`
+	Score     float64 `json:"score"`
+}
+
+// scoreDuplicate combina similitud de nombre, cercanía y familia de categoría.
+// Sin nombre que comparar, dos capturas de la misma categoría casi en el mismo punto siguen contando.
+func scoreDuplicate(shopName, category string, c *DuplicateCandidate) float64 {
+	cfg := duplicateConfig
+	c.NameScore = nameSimilarity(shopName, c.ShopName)
+	proximity := math.Max(0, 1-c.DistanceM/cfg.RadiusM)
+	family := 0.0
+	if category == c.Category {
+		family = 1
+	} else if categoryFamily(category) == categoryFamily(c.Category) {
+		family = 0.5
+	}
+	score := cfg.NameWeight*c.NameScore + cfg.DistWeight*proximity + cfg.FamilyWeight*family
+	if normalizeShopName(shopName) == "" && category == c.Category && c.DistanceM <= 20 {
+		score = math.Max(score, cfg.Threshold)
+	}
+	return math.Round(score*100) / 100
+}
+
+// findPossibleDuplicate devuelve el candidato con mayor puntaje si supera el umbral
+func findPossibleDuplicate(tx *gorm.DB, shopName, category string, lat, lng float64) (*DuplicateCandidate, error) {
+	var candidates []DuplicateCandidate
+	if err := tx.Raw(`
+		SELECT id, shop_name, category, status,
+			ST_Distance(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography) AS distance_m
+		FROM locations
+		WHERE status NOT IN ('rejected', 'merged')
+		AND ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)`,
+		lng, lat, lng, lat, duplicateConfig.RadiusM).Scan(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	return bestDuplicate(shopName, category, candidates), nil
+}
+
+// bestDuplicate puntúa los candidatos y devuelve el mejor si supera el umbral
+func bestDuplicate(shopName, category string, candidates []DuplicateCandidate) *DuplicateCandidate {
+	var best *DuplicateCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		c.Score = scoreDuplicate(shopName, category, c)
+		if c.Score >= duplicateConfig.Threshold && (best == nil || c.Score > best.Score) {
+			best = c
+		}
+	}
+	return best
+}
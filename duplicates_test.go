@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeShopName(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"Café Ñandú", "cafe nandu"},
+		{"  CAUCHOS PÉREZ  ", "cauchos perez"},
+		{"Taller El Gocho, C.A.", "taller gocho"},
+		{"Repuestos Los Andes S.R.L.", "repuestos andes"},
+		{"P.D.V. La Esquina", "pdv esquina"},
+		{"Lavado #1 (24h)", "lavado 1 24h"},
+		{"", ""},
+		{"de la", ""},
+	}
+	for _, tc := range cases {
+		if got := normalizeShopName(tc.in); got != tc.want {
+			t.Errorf("normalizeShopName(%q) = %q, esperaba %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		min, max float64
+	}{
+		{"Cauchos Pérez", "CAUCHOS PEREZ C.A.", 1, 1},
+		{"Café Ñandú", "cafe nandu", 1, 1},
+		{"Cauchos Pérez", "Cauchos Peres", 0.5, 0.99},
+		{"Cauchos Pérez", "Panadería Central", 0, 0.1},
+		{"", "Cauchos Pérez", 0, 0},
+	}
+	for _, tc := range cases {
+		got := nameSimilarity(tc.a, tc.b)
+		if got < tc.min || got > tc.max {
+			t.Errorf("nameSimilarity(%q, %q) = %.3f, esperaba entre %.2f y %.2f", tc.a, tc.b, got, tc.min, tc.max)
+		}
+		if rev := nameSimilarity(tc.b, tc.a); rev != got {
+			t.Errorf("nameSimilarity no es simétrica para %q / %q: %.3f vs %.3f", tc.a, tc.b, got, rev)
+		}
+	}
+}
+
+func TestCategoryFamily(t *testing.T) {
+	cases := []struct {
+		a, b string
+		same bool
+	}{
+		{"station_moto", "station_car", true},
+		{"station_car", "fuel_dollar", true},
+		{"mechanic", "tires", true},
+		{"mechanic", "parts", false},
+		{"food", "wash", false},
+		{"unknown", "unknown", true}, // Sin familia: la categoría es su propia familia
+	}
+	for _, tc := range cases {
+		if got := categoryFamily(tc.a) == categoryFamily(tc.b); got != tc.same {
+			t.Errorf("familia(%s) == familia(%s) = %t, esperaba %t", tc.a, tc.b, got, tc.same)
+		}
+	}
+}
+
+func TestScoreDuplicate(t *testing.T) {
+	cases := []struct {
+		name      string
+		shopName  string
+		category  string
+		candidate DuplicateCandidate
+		want      float64
+	}{
+		{"mismo nombre, categoría y punto", "Cauchos Pérez", "tires",
+			DuplicateCandidate{ShopName: "CAUCHOS PEREZ C.A.", Category: "tires"}, 1},
+		{"misma familia de categoría", "Bomba La Vaquera", "station_moto",
+			DuplicateCandidate{ShopName: "Bomba La Vaquera", Category: "fuel_dollar"}, 0.9},
+		{"categoría sin relación", "Cauchos Pérez", "food",
+			DuplicateCandidate{ShopName: "Cauchos Pérez", Category: "mechanic"}, 0.8},
+		{"justo en el radio de búsqueda", "Cauchos Pérez", "tires",
+			DuplicateCandidate{ShopName: "Cauchos Pérez", Category: "tires", DistanceM: duplicateConfig.RadiusM}, 0.75},
+		{"más allá del radio no resta de más", "Cauchos Pérez", "tires",
+			DuplicateCandidate{ShopName: "Cauchos Pérez", Category: "tires", DistanceM: 2 * duplicateConfig.RadiusM}, 0.75},
+		{"sin nombre, misma categoría a menos de 20 m", "", "wash",
+			DuplicateCandidate{ShopName: "Autolavado Sol", Category: "wash", DistanceM: 10}, duplicateConfig.Threshold},
+		{"sin nombre, misma categoría a más de 20 m", "", "wash",
+			DuplicateCandidate{ShopName: "Autolavado Sol", Category: "wash", DistanceM: 30}, 0.33},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.candidate
+			if got := scoreDuplicate(tc.shopName, tc.category, &c); math.Abs(got-tc.want) > 1e-9 {
+				t.Fatalf("score = %.2f, esperaba %.2f", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScoreDuplicateDifferentBusinessBelowThreshold(t *testing.T) {
+	c := DuplicateCandidate{ShopName: "Panadería Central", Category: "food"}
+	if got := scoreDuplicate("Cauchos Pérez", "tires", &c); got >= duplicateConfig.Threshold {
+		t.Fatalf("negocios distintos en el mismo punto: score %.2f supera el umbral %.2f", got, duplicateConfig.Threshold)
+	}
+}
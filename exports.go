@@ -0,0 +1,368 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- EXPORTACIONES (CSV, GeoJSON, NDJSON) ---
+//
+// Se leen con un cursor del servidor (DECLARE/FETCH) en tandas de exportFetchSize filas
+// y se escriben al vuelo: la memoria no crece con el tamaño de la exportación.
+
+const exportFetchSize = 1000
+
+// exportDataset columnas exportables de una tabla (lista cerrada: nunca PINs ni hashes)
+type exportDataset struct {
+	Table      string
+	Columns    []string
+	DateColumn string            // Para from/to (vacío = no admite rango)
+	Filters    map[string]string // Parámetro -> columna
+	Geo        bool              // Tiene latitude/longitude: admite GeoJSON
+	Numeric    map[string]bool   // Columnas numeric: se leen como float8 (el driver devuelve numeric como texto)
+	OrderBy    string
+}
+
+var exportDatasets = map[string]exportDataset{
+	"locations": {
+		Table: "locations",
+		Columns: []string{"id", "user_id", "vehicle_type", "shop_name", "category", "status", "latitude", "longitude",
+			"photo_url", "created_at", "reviewed_by", "review_reason", "reviewed_at", "merged_into", "import_id"},
+		DateColumn: "created_at",
+		Filters:    map[string]string{"category": "category", "status": "status", "vehicle_type": "vehicle_type"},
+		Geo:        true,
+		Numeric:    map[string]bool{"latitude": true, "longitude": true},
+		OrderBy:    "created_at, id",
+	},
+	"transactions": {
+		Table:      "transactions",
+		Columns:    []string{"id", "user_id", "vehicle_type", "type", "amount", "description", "location_id", "created_at"},
+		DateColumn: "created_at",
+		Filters:    map[string]string{"status": "type", "vehicle_type": "vehicle_type"}, // status = tipo de movimiento
+		Numeric:    map[string]bool{"amount": true},
+		OrderBy:    "created_at, id",
+	},
+	"wallets": {
+		Table: "wallets",
+		Columns: []string{"user_id", "balance_moto", "balance_car", "held_moto", "held_car", "lifetime_points",
+			"goal", "status", "level_name"},
+		Filters: map[string]string{"status": "status"},
+		Numeric: map[string]bool{"balance_moto": true, "balance_car": true, "held_moto": true, "held_car": true,
+			"lifetime_points": true, "goal": true},
+		OrderBy: "user_id",
+	},
+	"vehicles": {
+		Table:      "vehicles",
+		Columns:    []string{"id", "user_id", "user_email", "type", "brand", "model", "year", "status", "station_id", "created_at"},
+		DateColumn: "created_at",
+		Filters:    map[string]string{"status": "status", "vehicle_type": "type"},
+		OrderBy:    "created_at, id",
+	},
+}
+
+// parseExportDate acepta YYYY-MM-DD o RFC3339. Una fecha sin hora en 'to' incluye ese día completo.
+func parseExportDate(s string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return t, fmt.Errorf("fecha inválida: %s (usa YYYY-MM-DD)", s)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// exportQuery arma el SELECT con los filtros permitidos para el dataset
+func exportQuery(ds exportDataset, c *gin.Context) (string, []interface{}, error) {
+	var where []string
+	var args []interface{}
+
+	for _, param := range []string{"category", "status", "vehicle_type"} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		col, ok := ds.Filters[param]
+		if !ok {
+			return "", nil, fmt.Errorf("%s no admite el filtro %s", ds.Table, param)
+		}
+		where = append(where, col+" IN ?")
+		args = append(args, strings.Split(v, ","))
+	}
+	for param, op := range map[string]string{"from": ">=", "to": "<"} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		if ds.DateColumn == "" {
+			return "", nil, fmt.Errorf("%s no admite rango de fechas", ds.Table)
+		}
+		t, err := parseExportDate(v, param == "to")
+		if err != nil {
+			return "", nil, err
+		}
+		where = append(where, ds.DateColumn+" "+op+" ?")
+		args = append(args, t)
+	}
+
+	selects := make([]string, len(ds.Columns))
+	for i, col := range ds.Columns {
+		selects[i] = col
+		if ds.Numeric[col] {
+			selects[i] = col + "::float8 AS " + col
+		}
+	}
+	query := "SELECT " + strings.Join(selects, ", ") + " FROM " + ds.Table
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	return query + " ORDER BY " + ds.OrderBy, args, nil
+}
+
+// --- ESCRITORES ---
+
+type exportWriter interface {
+	Row(values []interface{}) error
+	Close() error
+}
+
+// exportValue normaliza lo que devuelve el driver para texto
+func exportValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return x.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case []byte:
+		return string(x)
+	}
+	return fmt.Sprint(v)
+}
+
+// exportJSONValue igual que exportValue pero conservando números y nulos en JSON
+func exportJSONValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case time.Time:
+		return x.UTC().Format(time.RFC3339)
+	case []byte:
+		return string(x)
+	}
+	return v
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func newCSVExportWriter(out io.Writer, columns []string) (*csvExportWriter, error) {
+	w := csv.NewWriter(out)
+	return &csvExportWriter{w: w}, w.Write(columns)
+}
+
+func (e *csvExportWriter) Row(values []interface{}) error {
+	rec := make([]string, len(values))
+	for i, v := range values {
+		rec[i] = exportValue(v)
+	}
+	return e.w.Write(rec)
+}
+
+func (e *csvExportWriter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonExportWriter struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+func (e *ndjsonExportWriter) Row(values []interface{}) error {
+	obj := make(map[string]interface{}, len(values))
+	for i, v := range values {
+		obj[e.columns[i]] = exportJSONValue(v)
+	}
+	return e.enc.Encode(obj) // Encode ya agrega el salto de línea
+}
+
+func (e *ndjsonExportWriter) Close() error { return nil }
+
+// geoJSONExportWriter escribe la FeatureCollection feature a feature
+type geoJSONExportWriter struct {
+	out      io.Writer
+	columns  []string
+	latIdx   int
+	lngIdx   int
+	idIdx    int
+	features int
+}
+
+func newGeoJSONExportWriter(out io.Writer, columns []string) (*geoJSONExportWriter, error) {
+	e := &geoJSONExportWriter{out: out, columns: columns, latIdx: -1, lngIdx: -1, idIdx: -1}
+	for i, col := range columns {
+		switch col {
+		case "latitude":
+			e.latIdx = i
+		case "longitude":
+			e.lngIdx = i
+		case "id":
+			e.idIdx = i
+		}
+	}
+	_, err := io.WriteString(out, `{"type":"FeatureCollection","features":[`)
+	return e, err
+}
+
+func (e *geoJSONExportWriter) Row(values []interface{}) error {
+	lat, okLat := values[e.latIdx].(float64)
+	lng, okLng := values[e.lngIdx].(float64)
+	if !okLat || !okLng {
+		return fmt.Errorf("fila %s sin coordenadas numéricas (%T, %T)", exportValue(values[e.idIdx]), values[e.latIdx], values[e.lngIdx])
+	}
+	props := map[string]interface{}{}
+	for i, v := range values {
+		if i != e.latIdx && i != e.lngIdx {
+			props[e.columns[i]] = exportJSONValue(v)
+		}
+	}
+	raw, err := json.Marshal(pointFeature(exportValue(values[e.idIdx]), lat, lng, props))
+	if err != nil {
+		return err
+	}
+	if e.features > 0 {
+		if _, err := io.WriteString(e.out, ","); err != nil {
+			return err
+		}
+	}
+	e.features++
+	_, err = e.out.Write(raw)
+	return err
+}
+
+func (e *geoJSONExportWriter) Close() error {
+	_, err := io.WriteString(e.out, "]}")
+	return err
+}
+
+// --- CONTROLADOR ---
+
+// exportData: GET /admin/exports/:dataset?format=csv|geojson|ndjson&from&to&category&status&vehicle_type
+func exportData(c *gin.Context) {
+	name := c.Param("dataset")
+	ds, ok := exportDatasets[name]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Dataset desconocido (locations, transactions, wallets, vehicles)"})
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	contentTypes := map[string]string{
+		"csv":     "text/csv; charset=utf-8",
+		"ndjson":  "application/x-ndjson",
+		"geojson": geoJSONContentType,
+	}
+	if _, ok := contentTypes[format]; !ok {
+		c.JSON(400, gin.H{"error": "format debe ser csv, geojson o ndjson"})
+		return
+	}
+	if format == "geojson" && !ds.Geo {
+		c.JSON(400, gin.H{"error": name + " no tiene coordenadas: usa csv o ndjson"})
+		return
+	}
+	query, args, err := exportQuery(ds, c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", contentTypes[format])
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().Format("20060102-150405"), format))
+	c.Status(200)
+
+	var out exportWriter
+	switch format {
+	case "csv":
+		out, err = newCSVExportWriter(c.Writer, ds.Columns)
+	case "ndjson":
+		out = &ndjsonExportWriter{enc: json.NewEncoder(c.Writer), columns: ds.Columns}
+	case "geojson":
+		out, err = newGeoJSONExportWriter(c.Writer, ds.Columns)
+	}
+	if err == nil {
+		err = streamExport(c, query, args, out)
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		// Las cabeceras ya salieron: solo queda cortar la respuesta y dejar rastro
+		log.Printf("❌ Exportación %s interrumpida: %v", name, err)
+		c.Abort()
+		return
+	}
+	log.Printf("📤 Exportación %s (%s) por %s", name, format, currentUserID(c))
+}
+
+// streamExport recorre la consulta con un cursor del servidor dentro de una transacción de solo lectura
+func streamExport(c *gin.Context, query string, args []interface{}, out exportWriter) error {
+	return db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET TRANSACTION READ ONLY").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DECLARE export_cursor NO SCROLL CURSOR FOR "+query, args...).Error; err != nil {
+			return err
+		}
+		for {
+			rows, err := tx.Raw(fmt.Sprintf("FETCH %d FROM export_cursor", exportFetchSize)).Rows()
+			if err != nil {
+				return err
+			}
+			n, err := writeExportRows(rows, out)
+			if err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			if n < exportFetchSize {
+				return nil
+			}
+		}
+	})
+}
+
+func writeExportRows(rows *sql.Rows, out exportWriter) (int, error) {
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		if err := out.Row(values); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
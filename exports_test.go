@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExportQueryCastsNumericColumns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/admin/exports/locations?status=approved", nil)
+
+	query, args, err := exportQuery(exportDatasets["locations"], c)
+	if err != nil {
+		t.Fatalf("exportQuery: %v", err)
+	}
+	for _, want := range []string{"latitude::float8 AS latitude", "longitude::float8 AS longitude", "WHERE status IN ?"} {
+		if !strings.Contains(query, want) {
+			t.Errorf("la consulta no contiene %q: %s", want, query)
+		}
+	}
+	if len(args) != 1 {
+		t.Errorf("esperaba 1 argumento, obtuve %d", len(args))
+	}
+}
+
+func TestGeoJSONExportWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newGeoJSONExportWriter(&buf, []string{"id", "latitude", "longitude", "shop_name"})
+	if err != nil {
+		t.Fatalf("creando writer: %v", err)
+	}
+	if err := w.Row([]interface{}{"a", 10.5, -66.9, "Bodega"}); err != nil {
+		t.Fatalf("Row: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var fc struct {
+		Features []struct {
+			Geometry struct {
+				Coordinates []float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &fc); err != nil {
+		t.Fatalf("GeoJSON inválido: %v\n%s", err, buf.String())
+	}
+	if len(fc.Features) != 1 {
+		t.Fatalf("esperaba 1 feature, obtuve %d", len(fc.Features))
+	}
+	if got := fc.Features[0].Geometry.Coordinates; len(got) != 2 || got[0] != -66.9 || got[1] != 10.5 {
+		t.Fatalf("coordenadas inesperadas: %v", got)
+	}
+	if fc.Features[0].Properties["shop_name"] != "Bodega" {
+		t.Fatalf("propiedades inesperadas: %v", fc.Features[0].Properties)
+	}
+}
+
+func TestGeoJSONExportWriterRejectsNonNumericCoords(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newGeoJSONExportWriter(&buf, []string{"id", "latitude", "longitude"})
+	if err != nil {
+		t.Fatalf("creando writer: %v", err)
+	}
+	// Lo que devolvería el driver para numeric sin el cast a float8
+	if err := w.Row([]interface{}{"a", "10.5", "-66.9"}); err == nil {
+		t.Fatal("esperaba error con coordenadas no numéricas")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- GEOJSON (RFC 7946) ---
+//
+// Con `Accept: application/geo+json` (o ?format=geojson, útil en QGIS) los endpoints del mapa
+// devuelven una FeatureCollection. Las propiedades se arman a mano: solo campos públicos.
+
+const geoJSONContentType = "application/geo+json"
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"` // [lng, lat]
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Geometry   geoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// wantsGeoJSON también marca Vary: la misma URL tiene dos representaciones
+func wantsGeoJSON(c *gin.Context) bool {
+	c.Header("Vary", "Accept")
+	return c.Query("format") == "geojson" || strings.Contains(c.GetHeader("Accept"), geoJSONContentType)
+}
+
+func pointFeature(id string, lat, lng float64, props map[string]interface{}) geoJSONFeature {
+	return geoJSONFeature{
+		Type:       "Feature",
+		ID:         id,
+		Geometry:   geoJSONPoint{Type: "Point", Coordinates: [2]float64{lng, lat}},
+		Properties: props,
+	}
+}
+
+func writeGeoJSON(c *gin.Context, features []geoJSONFeature) {
+	if features == nil {
+		features = []geoJSONFeature{}
+	}
+	// gin respeta un Content-Type ya fijado
+	c.Header("Content-Type", geoJSONContentType)
+	c.JSON(200, geoJSONCollection{Type: "FeatureCollection", Features: features})
+}
+
+// offerFeatures propiedades públicas de los puntos del mapa
+func offerFeatures(offers []OfferResponse) []geoJSONFeature {
+	features := make([]geoJSONFeature, 0, len(offers))
+	for _, o := range offers {
+		features = append(features, pointFeature(o.ID, o.Latitude, o.Longitude, map[string]interface{}{
+			"title":             o.Title,
+			"description":       o.Description,
+			"price":             o.Price,
+			"category":          o.Category,
+			"status":            o.Status,
+			"distance_meters":   o.Distance,
+			"remaining_seconds": o.RemainingSeconds,
+			"remaining_stock":   o.RemainingStock,
+		}))
+	}
+	return features
+}
+
+// PublicStation lo que se puede mostrar de una estación (nunca el PIN)
+type PublicStation struct {
+	ID        string  `json:"id"`
+	ShopName  string  `json:"shop_name"`
+	Category  string  `json:"category"`
+	Status    string  `json:"status"`
+	PhotoURL  string  `json:"photo_url"`
+	ThumbURL  string  `json:"thumb_url"`
+	Timezone  string  `json:"timezone"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+func stationFeatures(stations []PublicStation) []geoJSONFeature {
+	features := make([]geoJSONFeature, 0, len(stations))
+	for _, s := range stations {
+		features = append(features, pointFeature(s.ID, s.Latitude, s.Longitude, map[string]interface{}{
+			"shop_name": s.ShopName,
+			"category":  s.Category,
+			"status":    s.Status,
+			"photo_url": s.PhotoURL,
+			"thumb_url": s.ThumbURL,
+			"timezone":  s.Timezone,
+		}))
+	}
+	return features
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- CAZADORES (Allowlist en base de datos) ---
+
+const (
+	HunterInvited   = "invited"
+	HunterActive    = "active"
+	HunterSuspended = "suspended"
+)
+
+// Cuota diaria por defecto para nuevos cazadores
+const defaultHunterQuota = 50
+
+// Hunter (Cazador de campo autorizado a capturar puntos)
+type Hunter struct {
+	UserID            string    `gorm:"primaryKey" json:"user_id"`
+	Status            string    `gorm:"default:'invited';index" json:"status"`     // 'invited', 'active', 'suspended'
+	DailyQuota        int       `gorm:"default:50" json:"daily_quota"`             // 0 = sin límite
+	AllowedCategories []string  `gorm:"serializer:json" json:"allowed_categories"` // Vacío = todas las de huntCategories
+	InvitedBy         string    `json:"invited_by"`
+	SuspendedReason   string    `json:"suspended_reason"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// canCapture indica si el cazador puede capturar la categoría dada
+func (h *Hunter) canCapture(category string) bool {
+	if len(h.AllowedCategories) == 0 {
+		return true
+	}
+	for _, cat := range h.AllowedCategories {
+		if cat == category {
+			return true
+		}
+	}
+	return false
+}
+
+var errHunterNotFound = errors.New("cazador no encontrado")
+
+func findHunter(tx *gorm.DB, userID string) (*Hunter, error) {
+	var h Hunter
+	if err := tx.First(&h, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errHunterNotFound
+		}
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Zona horaria de la app (APP_TIMEZONE) para los cortes diarios; por defecto la de las estaciones
+const defaultAppTimezone = "America/Caracas"
+
+var appTimezone = time.UTC
+
+// capturesToday cuenta las capturas del cazador desde la medianoche en la zona de la app
+func capturesToday(tx *gorm.DB, userID string) (int64, error) {
+	now := time.Now().In(appTimezone)
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, appTimezone)
+	var count int64
+	err := tx.Model(&Location{}).Where("user_id = ? AND created_at >= ?", userID, startOfDay).Count(&count).Error
+	return count, err
+}
+
+// --- CONTROLADORES ---
+
+func listHunters(c *gin.Context) {
+	var hunters []Hunter
+	query := db.Order("created_at DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&hunters).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando cazadores"})
+		return
+	}
+	c.JSON(200, hunters)
+}
+
+func inviteHunter(c *gin.Context) {
+	var req struct {
+		UserID            string   `json:"user_id" binding:"required"`
+		DailyQuota        *int     `json:"daily_quota"`
+		AllowedCategories []string `json:"allowed_categories"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Faltan datos (user_id)"})
+		return
+	}
+	for _, cat := range req.AllowedCategories {
+		if !huntCategories[cat] {
+			c.JSON(400, gin.H{"error": "Categoría no permitida: " + cat})
+			return
+		}
+	}
+	quota := defaultHunterQuota
+	if req.DailyQuota != nil {
+		if *req.DailyQuota < 0 {
+			c.JSON(400, gin.H{"error": "daily_quota no puede ser negativa"})
+			return
+		}
+		quota = *req.DailyQuota
+	}
+
+	if _, err := findHunter(db, req.UserID); err == nil {
+		c.JSON(409, gin.H{"error": "El usuario ya es cazador"})
+		return
+	} else if !errors.Is(err, errHunterNotFound) {
+		c.JSON(500, gin.H{"error": "Error consultando cazador"})
+		return
+	}
+
+	hunter := Hunter{
+		UserID:            req.UserID,
+		Status:            HunterInvited,
+		DailyQuota:        quota,
+		AllowedCategories: req.AllowedCategories,
+		InvitedBy:         currentUserID(c),
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&hunter).Error; err != nil {
+			return err
+		}
+		return grantRole(tx, req.UserID, RoleHunter, "", currentUserID(c))
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error invitando cazador"})
+		return
+	}
+	log.Printf("🎯 Cazador %s invitado por %s", req.UserID, currentUserID(c))
+	c.JSON(201, hunter)
+}
+
+func updateHunterStatus(c *gin.Context, status string) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.ShouldBindJSON(&req) // El motivo es opcional
+
+	hunter, err := findHunter(db, c.Param("user_id"))
+	if err != nil {
+		if errors.Is(err, errHunterNotFound) {
+			c.JSON(404, gin.H{"error": "Cazador no encontrado"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Error consultando cazador"})
+		return
+	}
+
+	hunter.Status = status
+	hunter.SuspendedReason = ""
+	if status == HunterSuspended {
+		hunter.SuspendedReason = req.Reason
+	}
+	hunter.UpdatedAt = time.Now()
+	if err := db.Save(hunter).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error actualizando cazador"})
+		return
+	}
+	log.Printf("🎯 Cazador %s -> %s (por %s)", hunter.UserID, status, currentUserID(c))
+	c.JSON(200, hunter)
+}
+
+func suspendHunter(c *gin.Context)  { updateHunterStatus(c, HunterSuspended) }
+func activateHunter(c *gin.Context) { updateHunterStatus(c, HunterActive) }
+
+// acceptHunterInvite permite al propio cazador aceptar su invitación
+func acceptHunterInvite(c *gin.Context) {
+	res := db.Model(&Hunter{}).
+		Where("user_id = ? AND status = ?", currentUserID(c), HunterInvited).
+		Updates(map[string]interface{}{"status": HunterActive, "updated_at": time.Now()})
+	if res.Error != nil {
+		c.JSON(500, gin.H{"error": "Error aceptando invitación"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "No tienes invitaciones pendientes"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "¡Bienvenido, cazador!", "status": HunterActive})
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- IMPORTACIÓN MASIVA DE CAPTURAS (CSV, GeoJSON, KML) ---
+
+const (
+	ImportCommitted  = "committed"
+	ImportFailed     = "failed" // Falló a mitad: las tandas ya escritas se pueden revertir
+	ImportRolledBack = "rolled_back"
+
+	importBatchSize = 500
+	importMaxRows   = 50000
+	importMaxBytes  = 20 << 20
+)
+
+// LocationImport (Registro de cada importación confirmada)
+type LocationImport struct {
+	ID           string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	Format       string     `json:"format"`
+	FileName     string     `json:"file_name"`
+	Status       string     `json:"status"`
+	TotalRows    int        `json:"total_rows"`
+	Imported     int        `json:"imported"`
+	Skipped      int        `json:"skipped"`
+	CreatedBy    string     `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RolledBackAt *time.Time `json:"rolled_back_at"`
+}
+
+// importRow fila normalizada, venga del formato que venga
+type importRow struct {
+	Line     int     `json:"line"` // Línea (CSV) o posición del elemento (GeoJSON/KML), desde 1
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Lat      float64 `json:"latitude"`
+	Lng      float64 `json:"longitude"`
+}
+
+type importRowError struct {
+	Line  int    `json:"line"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// ImportReport resultado del dry run (y de la importación real)
+type ImportReport struct {
+	ImportID string           `json:"import_id,omitempty"`
+	DryRun   bool             `json:"dry_run"`
+	Total    int              `json:"total"`
+	Valid    int              `json:"valid"`
+	Imported int              `json:"imported"`
+	Errors   []importRowError `json:"errors"`
+}
+
+// importFormat deduce el formato por la extensión si no viene explícito
+func importFormat(format, fileName string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	}
+	switch format {
+	case "csv", "kml":
+		return format, nil
+	case "geojson", "json":
+		return "geojson", nil
+	}
+	return "", fmt.Errorf("formato no soportado: %q (csv, geojson o kml)", format)
+}
+
+func parseImport(format string, data []byte) ([]importRow, error) {
+	var rows []importRow
+	var err error
+	switch format {
+	case "csv":
+		rows, err = parseImportCSV(data)
+	case "geojson":
+		rows, err = parseImportGeoJSON(data)
+	case "kml":
+		rows, err = parseImportKML(data)
+	default:
+		return nil, fmt.Errorf("formato no soportado: %s", format)
+	}
+	if err == nil && len(rows) > importMaxRows {
+		return nil, fmt.Errorf("máximo %d filas por importación", importMaxRows)
+	}
+	return rows, err
+}
+
+// parseImportCSV cabecera obligatoria con name, category, lat, lng (acepta alias en español/inglés)
+func parseImportCSV(data []byte) ([]importRow, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CSV sin cabecera: %w", err)
+	}
+
+	aliases := map[string]string{
+		"name": "name", "shop_name": "name", "nombre": "name",
+		"category": "category", "categoria": "category",
+		"lat": "lat", "latitude": "lat", "latitud": "lat",
+		"lng": "lng", "lon": "lng", "longitude": "lng", "longitud": "lng",
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		if key, ok := aliases[strings.ToLower(strings.TrimSpace(h))]; ok {
+			cols[key] = i
+		}
+	}
+	for _, key := range []string{"name", "category", "lat", "lng"} {
+		if _, ok := cols[key]; !ok {
+			return nil, fmt.Errorf("falta la columna %s en la cabecera", key)
+		}
+	}
+
+	var rows []importRow
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("línea %d: %w", line, err)
+		}
+		field := func(key string) string {
+			if i := cols[key]; i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		row := importRow{Line: line, Name: field("name"), Category: field("category")}
+		// Coordenadas ilegibles quedan en NaN y se reportan en la validación
+		row.Lat = parseImportCoord(field("lat"))
+		row.Lng = parseImportCoord(field("lng"))
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseImportCoord(s string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return v
+}
+
+// parseImportGeoJSON FeatureCollection de Points; name/shop_name y category en properties
+func parseImportGeoJSON(data []byte) ([]importRow, error) {
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry *struct {
+				Type        string    `json:"type"`
+				Coordinates []float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("GeoJSON inválido: %w", err)
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, errors.New("se esperaba una FeatureCollection")
+	}
+
+	rows := make([]importRow, 0, len(fc.Features))
+	for i, f := range fc.Features {
+		row := importRow{Line: i + 1, Lat: math.NaN(), Lng: math.NaN()}
+		row.Name = propString(f.Properties, "name", "shop_name", "nombre")
+		row.Category = propString(f.Properties, "category", "categoria")
+		if f.Geometry != nil && f.Geometry.Type == "Point" && len(f.Geometry.Coordinates) >= 2 {
+			row.Lng, row.Lat = f.Geometry.Coordinates[0], f.Geometry.Coordinates[1]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func propString(props map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := props[k].(string); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// kmlPlacemark solo los campos que usamos; la categoría va en ExtendedData (Data name="category")
+type kmlPlacemark struct {
+	Name  string `xml:"name"`
+	Point struct {
+		Coordinates string `xml:"coordinates"`
+	} `xml:"Point"`
+	Data []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value"`
+	} `xml:"ExtendedData>Data"`
+}
+
+// parseImportKML recorre todos los Placemark, estén en Document o en Folders anidados
+func parseImportKML(data []byte) ([]importRow, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var rows []importRow
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("KML inválido: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Placemark" {
+			continue
+		}
+		var pm kmlPlacemark
+		if err := dec.DecodeElement(&pm, &start); err != nil {
+			return nil, fmt.Errorf("KML inválido: %w", err)
+		}
+		row := importRow{Line: len(rows) + 1, Name: strings.TrimSpace(pm.Name), Lat: math.NaN(), Lng: math.NaN()}
+		for _, d := range pm.Data {
+			if d.Name == "category" || d.Name == "categoria" {
+				row.Category = strings.TrimSpace(d.Value)
+			}
+		}
+		// "lng,lat[,alt]"
+		if parts := strings.Split(strings.TrimSpace(pm.Point.Coordinates), ","); len(parts) >= 2 {
+			row.Lng, row.Lat = parseImportCoord(parts[0]), parseImportCoord(parts[1])
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// validateImport aplica las mismas reglas que una captura: categoría permitida, coordenadas y duplicados
+// (contra el mapa y contra las filas anteriores del mismo archivo). Devuelve las filas válidas.
+func validateImport(ctx context.Context, rows []importRow) ([]importRow, []importRowError, error) {
+	problems := make([]string, len(rows))
+	var checkable []int
+	for i, r := range rows {
+		switch {
+		case r.Name == "":
+			problems[i] = "falta el nombre"
+		case !huntCategories[r.Category]:
+			problems[i] = "categoría no permitida: " + r.Category
+		case !validCoords(r.Lat, r.Lng):
+			problems[i] = "coordenadas inválidas"
+		default:
+			checkable = append(checkable, i)
+		}
+	}
+
+	// Duplicados contra el mapa: una consulta por tanda, no una por fila
+	dups := map[int]*DuplicateCandidate{}
+	for start := 0; start < len(checkable); start += importBatchSize {
+		batch := checkable[start:min(start+importBatchSize, len(checkable))]
+		if err := mapDuplicatesFor(db.WithContext(ctx), rows, batch, dups); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var valid []importRow
+	var errs []importRowError
+	for i, r := range rows {
+		msg := problems[i]
+		if msg == "" {
+			if dup := dups[i]; dup != nil {
+				msg = fmt.Sprintf("posible duplicado de %s (%s, %.0f m)", dup.ShopName, dup.ID, dup.DistanceM)
+			} else if prev := duplicateInFile(valid, r); prev != nil {
+				msg = fmt.Sprintf("duplicado de la fila %d del mismo archivo", prev.Line)
+			}
+		}
+		if msg != "" {
+			errs = append(errs, importRowError{Line: r.Line, Name: r.Name, Error: msg})
+			continue
+		}
+		valid = append(valid, r)
+	}
+	return valid, errs, nil
+}
+
+// mapDuplicatesFor busca en una sola consulta los candidatos de todas las filas 'idx'
+// (VALUES unido a locations con ST_DWithin) y deja en 'out' el mejor por fila.
+func mapDuplicatesFor(tx *gorm.DB, rows []importRow, idx []int, out map[int]*DuplicateCandidate) error {
+	values := make([]string, len(idx))
+	args := make([]interface{}, 0, len(idx)*3+1)
+	for k, i := range idx {
+		values[k] = "(?::int, ?::float8, ?::float8)"
+		args = append(args, i, rows[i].Lng, rows[i].Lat)
+	}
+	args = append(args, duplicateConfig.RadiusM)
+
+	var found []struct {
+		Idx int
+		DuplicateCandidate
+	}
+	if err := tx.Raw(`
+		WITH r (idx, lng, lat) AS (VALUES `+strings.Join(values, ", ")+`)
+		SELECT r.idx, l.id, l.shop_name, l.category, l.status,
+			ST_Distance(l.geom, ST_SetSRID(ST_MakePoint(r.lng, r.lat), 4326)::geography) AS distance_m
+		FROM r
+		JOIN locations l ON ST_DWithin(l.geom, ST_SetSRID(ST_MakePoint(r.lng, r.lat), 4326)::geography, ?)
+		WHERE l.status NOT IN ('rejected', 'merged')`, args...).Scan(&found).Error; err != nil {
+		return err
+	}
+
+	byRow := map[int][]DuplicateCandidate{}
+	for _, f := range found {
+		byRow[f.Idx] = append(byRow[f.Idx], f.DuplicateCandidate)
+	}
+	for i, candidates := range byRow {
+		if best := bestDuplicate(rows[i].Name, rows[i].Category, candidates); best != nil {
+			out[i] = best
+		}
+	}
+	return nil
+}
+
+// duplicateInFile mismo puntaje que findPossibleDuplicate, pero entre filas del archivo
+func duplicateInFile(accepted []importRow, r importRow) *importRow {
+	for i := range accepted {
+		prev := &accepted[i]
+		d := haversineMeters(r.Lat, r.Lng, prev.Lat, prev.Lng)
+		if d > duplicateConfig.RadiusM {
+			continue
+		}
+		cand := DuplicateCandidate{ShopName: prev.Name, Category: prev.Category, DistanceM: d}
+		if scoreDuplicate(r.Name, r.Category, &cand) >= duplicateConfig.Threshold {
+			return prev
+		}
+	}
+	return nil
+}
+
+// importFileError el archivo no se pudo interpretar (culpa del archivo, no de la infraestructura)
+type importFileError struct{ error }
+
+func (e importFileError) Unwrap() error { return e.error }
+
+// runImport valida y, si no es dry run, escribe en tandas. Con errores solo importa si skipInvalid.
+func runImport(ctx context.Context, format, fileName string, data []byte, dryRun, skipInvalid bool, userID string) (*ImportReport, error) {
+	rows, err := parseImport(format, data)
+	if err != nil {
+		return nil, importFileError{err}
+	}
+	valid, errs, err := validateImport(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	report := &ImportReport{DryRun: dryRun, Total: len(rows), Valid: len(valid), Errors: errs}
+	if report.Errors == nil {
+		report.Errors = []importRowError{}
+	}
+	if dryRun || len(valid) == 0 || (len(errs) > 0 && !skipInvalid) {
+		return report, nil
+	}
+
+	imp := LocationImport{
+		Format:    format,
+		FileName:  fileName,
+		Status:    ImportCommitted,
+		TotalRows: len(rows),
+		Skipped:   len(rows) - len(valid),
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+	if err := db.WithContext(ctx).Create(&imp).Error; err != nil {
+		return nil, err
+	}
+	report.ImportID = imp.ID
+
+	// Una transacción por tanda: un archivo grande no retiene locks mucho tiempo.
+	// Si una tanda falla, las anteriores quedan y se revierten con el import_id.
+	for start := 0; start < len(valid); start += importBatchSize {
+		batch := valid[start:min(start+importBatchSize, len(valid))]
+		if err := importBatch(db.WithContext(ctx), imp.ID, userID, batch); err != nil {
+			// WithoutCancel: si la tanda falló porque el cliente se fue, el estado igual debe quedar escrito
+			failed := map[string]interface{}{"status": ImportFailed, "imported": report.Imported}
+			if uerr := db.WithContext(context.WithoutCancel(ctx)).Model(&imp).Updates(failed).Error; uerr != nil {
+				// Las tandas anteriores ya están en locations: el operador necesita el id para revertir
+				log.Printf("❌ Importación %s: no se pudo marcar como fallida (%d filas escritas; usa import rollback %s): %v",
+					imp.ID, report.Imported, imp.ID, uerr)
+			}
+			return report, fmt.Errorf("tanda desde la fila %d: %w", batch[0].Line, err)
+		}
+		report.Imported += len(batch)
+	}
+	if err := db.Model(&imp).Update("imported", report.Imported).Error; err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func importBatch(conn *gorm.DB, importID, userID string, batch []importRow) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		locs := make([]Location, 0, len(batch))
+		for _, r := range batch {
+			locs = append(locs, Location{
+				UserID:    userID,
+				ShopName:  r.Name,
+				Category:  r.Category,
+				Latitude:  r.Lat,
+				Longitude: r.Lng,
+				Status:    "approved", // Carga administrativa: no pasa por la cola de moderación
+				ImportID:  &importID,
+			})
+		}
+		if err := tx.Create(&locs).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE locations SET geom = ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::geography
+			WHERE import_id = ? AND geom IS NULL`, importID).Error
+	})
+}
+
+// rollbackImport borra las capturas importadas que nadie referencia todavía.
+// Las que ya tienen vehículos, ofertas o fusiones se rechazan en lugar de borrarse.
+func rollbackImport(ctx context.Context, importID string) (deleted, rejected int64, err error) {
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var imp LocationImport
+		if err := tx.First(&imp, "id = ?", importID).Error; err != nil {
+			return err
+		}
+		if imp.Status == ImportRolledBack {
+			return errImportRolledBack
+		}
+
+		referenced := `(
+			EXISTS (SELECT 1 FROM vehicles v WHERE v.station_id = locations.id::text)
+			OR EXISTS (SELECT 1 FROM offers o WHERE o.location_id = locations.id)
+			OR EXISTS (SELECT 1 FROM location_merges m WHERE m.survivor_id = locations.id)
+			OR merged_into IS NOT NULL
+		)`
+		res := tx.Exec(`DELETE FROM locations WHERE import_id = ? AND NOT `+referenced, importID)
+		if res.Error != nil {
+			return res.Error
+		}
+		deleted = res.RowsAffected
+		res = tx.Exec(`UPDATE locations SET status = 'rejected', review_reason = 'other', review_note = 'Importación revertida'
+			WHERE import_id = ? AND status <> 'merged'`, importID)
+		if res.Error != nil {
+			return res.Error
+		}
+		rejected = res.RowsAffected
+		return tx.Model(&imp).Updates(map[string]interface{}{"status": ImportRolledBack, "rolled_back_at": time.Now()}).Error
+	})
+	return deleted, rejected, err
+}
+
+var errImportRolledBack = errors.New("la importación ya fue revertida")
+
+// --- CONTROLADORES ---
+
+// importLocations: multipart 'file' + format (opcional), dry_run (por defecto true), skip_invalid
+func importLocations(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Falta el archivo (file)"})
+		return
+	}
+	if file.Size > importMaxBytes {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("El archivo supera %d MB", importMaxBytes>>20)})
+		return
+	}
+	format, err := importFormat(c.PostForm("format"), file.Filename)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "No se pudo leer el archivo"})
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, importMaxBytes))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "No se pudo leer el archivo"})
+		return
+	}
+
+	dryRun := c.DefaultPostForm("dry_run", "true") != "false"
+	skipInvalid := c.PostForm("skip_invalid") == "true"
+	report, err := runImport(c.Request.Context(), format, file.Filename, data, dryRun, skipInvalid, currentUserID(c))
+	var fileErr importFileError
+	if errors.As(err, &fileErr) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil && report == nil {
+		log.Printf("❌ Error validando importación: %v", err)
+		c.JSON(500, gin.H{"error": "Error validando importación"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Importación %s incompleta: %v", report.ImportID, err)
+		c.JSON(500, gin.H{"error": "Importación incompleta: " + err.Error(), "report": report})
+		return
+	}
+	if !dryRun && report.ImportID == "" && len(report.Errors) > 0 {
+		c.JSON(422, gin.H{"error": "Hay filas con errores (usa skip_invalid=true para importar solo las válidas)", "report": report})
+		return
+	}
+	if report.ImportID != "" {
+		log.Printf("📥 Importación %s por %s: %d capturas", report.ImportID, currentUserID(c), report.Imported)
+	}
+	c.JSON(200, report)
+}
+
+func listImports(c *gin.Context) {
+	var list []LocationImport
+	if err := db.Order("created_at DESC").Limit(100).Find(&list).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando importaciones"})
+		return
+	}
+	c.JSON(200, list)
+}
+
+func rollbackImportHandler(c *gin.Context) {
+	deleted, rejected, err := rollbackImport(c.Request.Context(), c.Param("id"))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "Importación no encontrada"})
+		return
+	case errors.Is(err, errImportRolledBack):
+		c.JSON(409, gin.H{"error": "La importación ya fue revertida"})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": "Error revirtiendo importación"})
+		return
+	}
+	log.Printf("📥 Importación %s revertida por %s (%d borradas, %d rechazadas)", c.Param("id"), currentUserID(c), deleted, rejected)
+	c.JSON(200, gin.H{"message": "Importación revertida", "deleted": deleted, "rejected": rejected})
+}
+
+// runImportCommand implementa:
+//
+//	import <archivo> [--format csv|geojson|kml] [--commit] [--skip-invalid] [--as <uid>]
+//	import rollback <import_id>
+func runImportCommand(args []string) error {
+	usage := fmt.Errorf("uso: import <archivo> [--format f] [--commit] [--skip-invalid] [--as uid] | import rollback <id>")
+	if len(args) == 0 {
+		return usage
+	}
+	ctx := context.Background()
+	if args[0] == "rollback" {
+		if len(args) != 2 {
+			return usage
+		}
+		deleted, rejected, err := rollbackImport(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Importación %s revertida: %d borradas, %d rechazadas (referenciadas)\n", args[1], deleted, rejected)
+		return nil
+	}
+
+	path, format, commit, skipInvalid, userID := args[0], "", false, false, "cli-import"
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--commit":
+			commit = true
+		case "--skip-invalid":
+			skipInvalid = true
+		case "--format", "--as":
+			if i+1 >= len(args) {
+				return usage
+			}
+			if args[i] == "--format" {
+				format = args[i+1]
+			} else {
+				userID = args[i+1]
+			}
+			i++
+		default:
+			return usage
+		}
+	}
+	format, err := importFormat(format, path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	report, err := runImport(ctx, format, filepath.Base(path), data, !commit, skipInvalid, userID)
+	if report != nil {
+		for _, e := range report.Errors {
+			fmt.Printf("línea %-6d %-32s %s\n", e.Line, e.Name, e.Error)
+		}
+		fmt.Printf("Total %d, válidas %d, importadas %d\n", report.Total, report.Valid, report.Imported)
+	}
+	switch {
+	case err != nil:
+		return err
+	case report.ImportID != "":
+		fmt.Printf("✅ Importación %s (revertir con: import rollback %s)\n", report.ImportID, report.ImportID)
+	case commit && len(report.Errors) > 0:
+		return fmt.Errorf("%d filas con errores (usa --skip-invalid)", len(report.Errors))
+	case !commit:
+		fmt.Println("Dry run: nada se escribió (usa --commit)")
+	}
+	return nil
+}
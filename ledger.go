@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- LIBRO MAYOR DE PUNTOS (Partida doble) ---
+//
+// Cada movimiento debita una cuenta y acredita otra por el mismo monto.
+// Cuentas de usuario: user:<uid>:moto, user:<uid>:car, user:<uid>:held_moto, user:<uid>:held_car.
+// Saldo de una cuenta = créditos - débitos. Las columnas de Wallet son solo una proyección.
+
+// Cuentas del sistema
+const (
+	AcctRewards = "system:rewards" // Origen de todos los puntos emitidos
+	AcctPayouts = "system:payouts" // Destino de los canjes pagados
+)
+
+// Tipos de Transaction (historial visible para el usuario)
+const (
+	TxEarning  = "earning"
+	TxClawback = "clawback" // Reversión de una captura rechazada o fusionada
+	TxRestore  = "restore"  // Devolución de un clawback (p.ej. al deshacer una fusión)
+)
+
+// LedgerEntry (Asiento inmutable: un trigger impide UPDATE/DELETE)
+type LedgerEntry struct {
+	ID            string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	TransactionID *string   `gorm:"type:uuid;index" json:"transaction_id"`
+	DebitAccount  string    `gorm:"index" json:"debit_account"`
+	CreditAccount string    `gorm:"index" json:"credit_account"`
+	Amount        float64   `json:"amount"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func userAccount(userID, vehicleType string) string {
+	if vehicleType == "car" {
+		return "user:" + userID + ":car"
+	}
+	return "user:" + userID + ":moto"
+}
+
+func userHeldAccount(userID, vehicleType string) string {
+	if vehicleType == "car" {
+		return "user:" + userID + ":held_car"
+	}
+	return "user:" + userID + ":held_moto"
+}
+
+// walletColumnFor traduce una cuenta de usuario a (uid, columna de Wallet)
+func walletColumnFor(account string) (userID, column string, ok bool) {
+	if !strings.HasPrefix(account, "user:") {
+		return "", "", false
+	}
+	i := strings.LastIndex(account, ":")
+	if i < len("user:") {
+		return "", "", false
+	}
+	userID, kind := account[len("user:"):i], account[i+1:]
+	switch kind {
+	case "moto", "car":
+		return userID, "balance_" + kind, true
+	case "held_moto", "held_car":
+		return userID, kind, true
+	}
+	return "", "", false
+}
+
+// Posting describe un movimiento de puntos
+type Posting struct {
+	UserID      string
+	VehicleType string
+	Type        string // Transaction.Type
+	Description string
+	LocationID  string // Opcional: captura asociada
+	Debit       string
+	Credit      string
+	Amount      float64 // Siempre > 0
+}
+
+var errInvalidPosting = errors.New("asiento inválido")
+
+// postPoints escribe el asiento, el registro de historial y actualiza la proyección de Wallet.
+// Debe llamarse dentro de una transacción de DB.
+func postPoints(tx *gorm.DB, p Posting) (*Transaction, error) {
+	if p.Amount <= 0 || math.IsNaN(p.Amount) || p.Debit == p.Credit {
+		return nil, errInvalidPosting
+	}
+
+	// Monto visible: cómo cambia el saldo disponible del usuario
+	history := 0.0
+	if p.Credit == userAccount(p.UserID, p.VehicleType) {
+		history = p.Amount
+	} else if p.Debit == userAccount(p.UserID, p.VehicleType) {
+		history = -p.Amount
+	}
+
+	now := time.Now()
+	trans := Transaction{
+		UserID:      p.UserID,
+		VehicleType: p.VehicleType,
+		Type:        p.Type,
+		Amount:      history,
+		Description: p.Description,
+		CreatedAt:   now,
+	}
+	if p.LocationID != "" {
+		trans.LocationID = &p.LocationID
+	}
+	if err := tx.Create(&trans).Error; err != nil {
+		return nil, err
+	}
+
+	entry := LedgerEntry{
+		TransactionID: &trans.ID,
+		DebitAccount:  p.Debit,
+		CreditAccount: p.Credit,
+		Amount:        p.Amount,
+		CreatedAt:     now,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	if err := projectEntry(tx, &entry); err != nil {
+		return nil, err
+	}
+	return &trans, nil
+}
+
+// projectEntry aplica el asiento a las columnas de Wallet afectadas
+func projectEntry(tx *gorm.DB, e *LedgerEntry) error {
+	deltas := map[string]map[string]float64{} // uid -> columna -> delta
+	add := func(account string, amount float64) {
+		if uid, col, ok := walletColumnFor(account); ok {
+			if deltas[uid] == nil {
+				deltas[uid] = map[string]float64{}
+			}
+			deltas[uid][col] += amount
+		}
+	}
+	add(e.CreditAccount, e.Amount)
+	add(e.DebitAccount, -e.Amount)
+
+	// Puntos de por vida: todo lo emitido (o revertido) contra system:rewards
+	if e.DebitAccount == AcctRewards {
+		if uid, col, ok := walletColumnFor(e.CreditAccount); ok && strings.HasPrefix(col, "balance_") {
+			deltas[uid]["lifetime_points"] += e.Amount
+		}
+	}
+	if e.CreditAccount == AcctRewards {
+		if uid, col, ok := walletColumnFor(e.DebitAccount); ok && strings.HasPrefix(col, "balance_") {
+			deltas[uid]["lifetime_points"] -= e.Amount
+		}
+	}
+
+	for uid, cols := range deltas {
+		if err := ensureWallet(tx, uid); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{}
+		for col, d := range cols {
+			updates[col] = gorm.Expr("COALESCE("+col+", 0) + ?", d)
+		}
+		if err := tx.Model(&Wallet{}).Where("user_id = ?", uid).Updates(updates).Error; err != nil {
+			return err
+		}
+		// Subida de nivel en la misma transacción que el asiento
+		if cols["lifetime_points"] > 0 {
+			if err := promoteWallet(tx, uid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ensureWallet crea la billetera vacía si no existe
+func ensureWallet(tx *gorm.DB, userID string) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Wallet{
+		UserID:    userID,
+		Goal:      defaultLevelGoal,
+		Status:    "active",
+		LevelName: defaultLevelName,
+	}).Error
+}
+
+// --- CONCILIACIÓN ---
+
+// WalletDrift diferencia entre la proyección (wallets) y el libro mayor
+type WalletDrift struct {
+	UserID string
+	Column string
+	Wallet float64
+	Ledger float64
+}
+
+// ledgerProjection recalcula desde cero las columnas de Wallet a partir del libro mayor
+const ledgerProjection = `
+	WITH moves AS (
+		SELECT credit_account AS account, amount, debit_account AS other FROM ledger_entries
+		UNION ALL
+		SELECT debit_account, -amount, credit_account FROM ledger_entries
+	), parsed AS (
+		-- Mismo criterio que walletColumnFor: el tipo es el último segmento y el uid todo lo anterior
+		SELECT substring(account from '^user:(.*):[^:]*$') AS user_id,
+			substring(account from '[^:]*$') AS kind,
+			amount, other
+		FROM moves
+		WHERE account LIKE 'user:%'
+	), per_user AS (
+		SELECT
+			user_id,
+			SUM(CASE WHEN kind = 'moto' THEN amount ELSE 0 END) AS balance_moto,
+			SUM(CASE WHEN kind = 'car' THEN amount ELSE 0 END) AS balance_car,
+			SUM(CASE WHEN kind = 'held_moto' THEN amount ELSE 0 END) AS held_moto,
+			SUM(CASE WHEN kind = 'held_car' THEN amount ELSE 0 END) AS held_car,
+			SUM(CASE WHEN other = 'system:rewards' AND kind IN ('moto', 'car') THEN amount ELSE 0 END) AS lifetime_points
+		FROM parsed
+		GROUP BY 1
+	)
+	SELECT COALESCE(w.user_id, p.user_id) AS user_id,
+		COALESCE(w.balance_moto, 0) AS w_balance_moto, COALESCE(p.balance_moto, 0) AS l_balance_moto,
+		COALESCE(w.balance_car, 0) AS w_balance_car, COALESCE(p.balance_car, 0) AS l_balance_car,
+		COALESCE(w.held_moto, 0) AS w_held_moto, COALESCE(p.held_moto, 0) AS l_held_moto,
+		COALESCE(w.held_car, 0) AS w_held_car, COALESCE(p.held_car, 0) AS l_held_car,
+		COALESCE(w.lifetime_points, 0) AS w_lifetime_points, COALESCE(p.lifetime_points, 0) AS l_lifetime_points
+	FROM wallets w FULL OUTER JOIN per_user p ON p.user_id = w.user_id`
+
+// reconcileWallets compara wallets contra el libro mayor; con fix=true corrige la proyección
+func reconcileWallets(ctx context.Context, fix bool) ([]WalletDrift, error) {
+	var drifts []WalletDrift
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Evita que entren asientos mientras se compara
+		if err := tx.Exec("LOCK TABLE ledger_entries IN SHARE MODE").Error; err != nil {
+			return err
+		}
+		rows, err := tx.Raw(ledgerProjection).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		cols := []string{"balance_moto", "balance_car", "held_moto", "held_car", "lifetime_points"}
+		fixes := map[string]map[string]interface{}{}
+		for rows.Next() {
+			var userID string
+			vals := make([]float64, len(cols)*2)
+			dest := []interface{}{&userID}
+			for i := range vals {
+				dest = append(dest, &vals[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				return err
+			}
+			for i, col := range cols {
+				w, l := vals[i*2], vals[i*2+1]
+				if math.Abs(w-l) > 1e-6 {
+					drifts = append(drifts, WalletDrift{UserID: userID, Column: col, Wallet: w, Ledger: l})
+					if fixes[userID] == nil {
+						fixes[userID] = map[string]interface{}{}
+					}
+					fixes[userID][col] = l
+				}
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if !fix {
+			return nil
+		}
+		for uid, updates := range fixes {
+			if err := ensureWallet(tx, uid); err != nil {
+				return err
+			}
+			if err := tx.Model(&Wallet{}).Where("user_id = ?", uid).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return drifts, err
+}
+
+// runLedgerCommand implementa `ledger reconcile [--fix]`
+func runLedgerCommand(args []string) error {
+	if len(args) == 0 || args[0] != "reconcile" {
+		return fmt.Errorf("uso: ledger reconcile [--fix]")
+	}
+	fix := len(args) > 1 && args[1] == "--fix"
+
+	drifts, err := reconcileWallets(context.Background(), fix)
+	if err != nil {
+		return err
+	}
+	for _, d := range drifts {
+		fmt.Printf("%-32s %-16s wallet=%.2f ledger=%.2f diff=%+.2f\n", d.UserID, d.Column, d.Wallet, d.Ledger, d.Wallet-d.Ledger)
+	}
+	switch {
+	case len(drifts) == 0:
+		fmt.Println("✅ Sin diferencias: wallets cuadra con el libro mayor")
+	case fix:
+		fmt.Printf("🔧 %d diferencias corregidas\n", len(drifts))
+	default:
+		return fmt.Errorf("%d diferencias encontradas (usa --fix para corregir)", len(drifts))
+	}
+	return nil
+}
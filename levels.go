@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- NIVELES (Progresión por puntos de por vida) ---
+//
+// Cuando un asiento sube lifetime_points por encima del umbral de un nivel, la billetera
+// se promueve en la misma transacción y queda un LevelUp como evento.
+// Los niveles no se pierden: un clawback baja los puntos pero no degrada el nivel.
+
+// Nivel inicial (también el de las billeteras recién creadas)
+const (
+	defaultLevelName = "Novato"
+	defaultLevelGoal = 500
+)
+
+// Level (Nivel alcanzable por puntos de por vida)
+type Level struct {
+	ID        string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	Name      string    `json:"name"`
+	Threshold float64   `json:"threshold"`                    // lifetime_points necesarios
+	Goal      float64   `json:"goal"`                         // Meta de canje del nivel (Wallet.Goal)
+	Perks     []string  `gorm:"serializer:json" json:"perks"` // Beneficios visibles en la app
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LevelUp (Evento de promoción; se escribe en la misma transacción que el asiento)
+type LevelUp struct {
+	ID             string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	UserID         string    `gorm:"index" json:"user_id"`
+	FromLevel      string    `json:"from_level"`
+	ToLevel        string    `json:"to_level"`
+	LifetimePoints float64   `json:"lifetime_points"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func loadLevels(tx *gorm.DB) ([]Level, error) {
+	var levels []Level
+	err := tx.Order("threshold ASC").Find(&levels).Error
+	return levels, err
+}
+
+// reachedLevel índice del nivel más alto con umbral <= points (-1 si ninguno)
+func reachedLevel(levels []Level, points float64) int {
+	idx := -1
+	for i, l := range levels {
+		if points >= l.Threshold {
+			idx = i
+		}
+	}
+	return idx
+}
+
+func levelIndex(levels []Level, name string) int {
+	for i, l := range levels {
+		if l.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// promoteWallet sube de nivel la billetera si sus puntos de por vida lo permiten.
+// Debe llamarse dentro de la transacción que movió lifetime_points.
+func promoteWallet(tx *gorm.DB, userID string) error {
+	levels, err := loadLevels(tx)
+	if err != nil || len(levels) == 0 {
+		return err
+	}
+	var wallet Wallet
+	if err := tx.First(&wallet, "user_id = ?", userID).Error; err != nil {
+		return err
+	}
+	target := reachedLevel(levels, wallet.LifetimePoints)
+	if target < 0 || target <= levelIndex(levels, wallet.LevelName) {
+		return nil
+	}
+
+	level := levels[target]
+	if err := tx.Model(&Wallet{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+		"level_name": level.Name,
+		"goal":       level.Goal,
+	}).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(&LevelUp{
+		UserID:         userID,
+		FromLevel:      wallet.LevelName,
+		ToLevel:        level.Name,
+		LifetimePoints: wallet.LifetimePoints,
+		CreatedAt:      time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+	log.Printf("🏅 [SILENT PUSH] ¡Subiste a %s! [UID: %s] (%s -> %s, %.0f pts)", level.Name, userID, wallet.LevelName, level.Name, wallet.LifetimePoints)
+	return nil
+}
+
+// LevelProgress avance hacia el siguiente nivel (para la vista de billetera)
+type LevelProgress struct {
+	Level         string   `json:"level"`
+	Perks         []string `json:"perks"`
+	NextLevel     *string  `json:"next_level"` // nil = nivel máximo
+	NextThreshold *float64 `json:"next_threshold"`
+	PointsToNext  float64  `json:"points_to_next"`
+	Percent       float64  `json:"percent"` // 0-100 dentro del tramo actual
+}
+
+func levelProgress(levels []Level, wallet *Wallet) LevelProgress {
+	p := LevelProgress{Level: wallet.LevelName, Perks: []string{}, Percent: 100}
+	current := levelIndex(levels, wallet.LevelName)
+	floor := 0.0
+	if current >= 0 {
+		p.Perks = levels[current].Perks
+		floor = levels[current].Threshold
+	}
+	if current+1 >= len(levels) {
+		return p
+	}
+	next := levels[current+1]
+	p.NextLevel, p.NextThreshold = &next.Name, &next.Threshold
+	p.PointsToNext = math.Max(0, next.Threshold-wallet.LifetimePoints)
+	if span := next.Threshold - floor; span > 0 {
+		p.Percent = roundPoints(math.Min(100, math.Max(0, (wallet.LifetimePoints-floor)/span*100)))
+	}
+	return p
+}
+
+// --- ADMINISTRACIÓN ---
+
+type levelRequest struct {
+	Name      string   `json:"name"`
+	Threshold float64  `json:"threshold"`
+	Goal      float64  `json:"goal"`
+	Perks     []string `json:"perks"`
+}
+
+func (req *levelRequest) validate() string {
+	switch {
+	case req.Name == "":
+		return "Falta el nombre del nivel"
+	case req.Threshold < 0 || math.IsNaN(req.Threshold) || math.IsInf(req.Threshold, 0):
+		return "threshold no puede ser negativo"
+	case req.Goal <= 0 || math.IsNaN(req.Goal) || math.IsInf(req.Goal, 0):
+		return "goal debe ser mayor que 0"
+	}
+	return ""
+}
+
+// listLevels es público para la app (tabla de niveles y beneficios)
+func listLevels(c *gin.Context) {
+	levels, err := loadLevels(db)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando niveles"})
+		return
+	}
+	c.JSON(200, levels)
+}
+
+// saveLevel crea (level.ID vacío) o actualiza un nivel; nombre y umbral son únicos
+func saveLevel(c *gin.Context, level *Level) {
+	var req levelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
+	var clash int64
+	q := db.Model(&Level{}).Where("(name = ? OR threshold = ?)", req.Name, req.Threshold)
+	if level.ID != "" {
+		q = q.Where("id <> ?", level.ID)
+	}
+	if err := q.Count(&clash).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando niveles"})
+		return
+	}
+	if clash > 0 {
+		c.JSON(409, gin.H{"error": "Ya existe un nivel con ese nombre o umbral"})
+		return
+	}
+
+	oldName, oldGoal := level.Name, level.Goal
+	level.Name, level.Threshold, level.Goal, level.Perks = req.Name, req.Threshold, req.Goal, req.Perks
+	if level.Perks == nil {
+		level.Perks = []string{}
+	}
+	level.UpdatedAt = time.Now()
+	code := 200
+	if level.ID == "" {
+		level.CreatedAt = level.UpdatedAt
+		code = 201
+	}
+	// Las billeteras existentes se promueven en su próximo asiento
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(level).Error; err != nil {
+			return err
+		}
+		// Wallet copia nombre y meta: las billeteras de ese nivel siguen al nivel editado
+		if oldName == "" || (oldName == level.Name && oldGoal == level.Goal) {
+			return nil
+		}
+		return tx.Model(&Wallet{}).Where("level_name = ?", oldName).
+			Updates(map[string]interface{}{"level_name": level.Name, "goal": level.Goal}).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error guardando nivel"})
+		return
+	}
+	c.JSON(code, level)
+}
+
+func createLevel(c *gin.Context) { saveLevel(c, &Level{}) }
+
+func loadLevel(c *gin.Context) (*Level, bool) {
+	var level Level
+	if err := db.First(&level, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "Nivel no encontrado"})
+		} else {
+			c.JSON(500, gin.H{"error": "Error consultando nivel"})
+		}
+		return nil, false
+	}
+	return &level, true
+}
+
+func updateLevel(c *gin.Context) {
+	if level, ok := loadLevel(c); ok {
+		saveLevel(c, level)
+	}
+}
+
+func deleteLevel(c *gin.Context) {
+	level, ok := loadLevel(c)
+	if !ok {
+		return
+	}
+	var moved int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(level).Error; err != nil {
+			return err
+		}
+		levels, err := loadLevels(tx)
+		if err != nil || len(levels) == 0 {
+			return err
+		}
+		// Las billeteras del nivel borrado pasan al nivel inmediatamente inferior (o al más bajo)
+		target := levels[0]
+		for _, l := range levels {
+			if l.Threshold <= level.Threshold {
+				target = l
+			}
+		}
+		res := tx.Model(&Wallet{}).Where("level_name = ?", level.Name).
+			Updates(map[string]interface{}{"level_name": target.Name, "goal": target.Goal})
+		moved = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error eliminando nivel"})
+		return
+	}
+	if moved > 0 {
+		log.Printf("🏅 Nivel %s eliminado por %s: %d billeteras reasignadas", level.Name, currentUserID(c), moved)
+	}
+	c.JSON(200, gin.H{"message": "Nivel eliminado", "wallets_moved": moved})
+}
@@ -1,25 +1,22 @@
 package main
 
 import (
+	"crypto/hmac"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
+	_ "time/tzdata" // Zonas IANA embebidas (la imagen puede no traer /usr/share/zoneinfo)
 
-	"cloud.google.com/go/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"bytes"
 	"context"
 	"fmt"
-	"io"
-
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/option"
-	"google.golang.org/api/transport"
 )
 
 // --- MODELOS ---
@@ -35,6 +32,9 @@ type OfferResponse struct {
 	Latitude    float64 `json:"latitude"`
 	Longitude   float64 `json:"longitude"`
 	Distance    float64 `json:"distance_meters"`
+	// Solo ofertas flash (null en el resto)
+	RemainingSeconds *int64 `json:"remaining_seconds"`
+	RemainingStock   *int64 `json:"remaining_stock"`
 }
 
 // Vehículos (Para el usuario)
@@ -49,7 +49,7 @@ type Vehicle struct {
 	Year      int       `json:"year"`
 	IsActive  bool      `gorm:"default:true" json:"is_active"`
 	Status    string    `gorm:"default:'SHADOW'" json:"status"` // 'SHADOW', 'ACTIVE', 'REJECTED'
-	Role      string    `gorm:"default:'driver'" json:"role"`   // 'driver', 'station_admin'
+	Role      string    `gorm:"default:'driver'" json:"role"`   // Espejo legado para el FE; la autorización usa UserRole
 	StationID string    `json:"station_id"`                     // ID de la estación vinculada
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -60,28 +60,52 @@ type Wallet struct {
 	BalanceMoto    float64 `json:"balance_moto"`
 	BalanceCar     float64 `json:"balance_car"`
 	LifetimePoints float64 `json:"lifetime_points"`
-	Goal           float64 `gorm:"default:500" json:"goal"`
+	Goal           float64 `gorm:"default:500" json:"goal"`        // Meta de canje del nivel actual
 	Status         string  `gorm:"default:'active'" json:"status"` // 'active', 'pending', 'frozen'
 	LevelName      string  `gorm:"default:'Novato'" json:"level_name"`
+	HeldMoto       float64 `gorm:"default:0" json:"held_moto"` // Retenido por canjes en curso
+	HeldCar        float64 `gorm:"default:0" json:"held_car"`
 }
 
 // Location (Puntos cazados)
 type Location struct {
-	ID               string      `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
-	UserID           string      `gorm:"index" json:"user_id"`
-	VehicleType      string      `json:"vehicle_type"` // 'moto' o 'car'
-	ShopName         string      `json:"shop_name"`
-	Category         string      `json:"category"`
-	PhotoURL         string      `json:"photo_url"`
-	Latitude         float64     `json:"latitude"`
-	Longitude        float64     `json:"longitude"`
-	Status           string      `gorm:"default:'pending'" json:"status"` // 'pending', 'approved', 'rejected'
-	IsShadow         bool        `json:"is_shadow"`
-	ActivationStatus string      `json:"activation_status"`
-	AssetType        string      `json:"asset_type"`
-	DailyPIN         string      `json:"daily_pin"`
-	PINUpdatedAt     time.Time   `json:"pin_updated_at"`
-	Geom             interface{} `gorm:"type:geography(POINT,4326)" json:"-"`
+	ID               string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	UserID           string    `gorm:"index" json:"user_id"`
+	VehicleType      string    `json:"vehicle_type"` // 'moto' o 'car'
+	ShopName         string    `json:"shop_name"`
+	Category         string    `json:"category"`
+	PhotoURL         string    `json:"photo_url"`
+	ThumbURL         string    `json:"thumb_url"`
+	MediumURL        string    `json:"medium_url"`
+	Latitude         float64   `json:"latitude"`
+	Longitude        float64   `json:"longitude"`
+	Status           string    `gorm:"default:'pending'" json:"status"` // 'pending', 'approved', 'rejected', 'merged'
+	IsShadow         bool      `json:"is_shadow"`
+	ActivationStatus string    `json:"activation_status"`
+	AssetType        string    `json:"asset_type"`
+	DailyPIN         string    `json:"-"` // Nunca se serializa: solo el station_admin lo ve (getUserVehicles)
+	PINUpdatedAt     time.Time `json:"pin_updated_at"`
+	PINEpoch         int       `json:"-"`                                         // Rotaciones forzadas en el día local
+	Timezone         string    `gorm:"default:'America/Caracas'" json:"timezone"` // Zona IANA de la estación
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+	// Moderación
+	ReviewedBy   string     `json:"reviewed_by"`
+	ReviewReason string     `json:"review_reason"` // Código: ver rejectReasons
+	ReviewNote   string     `json:"review_note"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+	// Verificación de la foto: distancia entre el GPS del EXIF y las coordenadas enviadas
+	PhotoGPSDistance *float64 `json:"photo_gps_distance"`
+	GPSMismatch      bool     `gorm:"index" json:"gps_mismatch"`
+	// Foto repetida: dHash de la foto y captura más parecida si supera el umbral
+	PhotoHash         *int64  `json:"-"`
+	DuplicatePhotoOf  *string `gorm:"type:uuid;index" json:"duplicate_photo_of"`
+	PhotoHashDistance *int    `json:"photo_hash_distance"`
+	// Duplicado por nombre/distancia que el cazador confirmó como negocio distinto
+	PossibleDuplicateOf *string     `gorm:"type:uuid;index" json:"possible_duplicate_of"`
+	DuplicateScore      *float64    `json:"duplicate_score"`
+	MergedInto          *string     `gorm:"type:uuid;index" json:"merged_into"` // Superviviente si status = 'merged'
+	ImportID            *string     `gorm:"type:uuid;index" json:"import_id"`   // Carga masiva que la creó (ver imports.go)
+	Geom                interface{} `gorm:"type:geography(POINT,4326)" json:"-"`
 }
 
 // Transaction (Historial de puntos)
@@ -89,13 +113,16 @@ type Transaction struct {
 	ID          string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
 	UserID      string    `gorm:"index" json:"user_id"`
 	VehicleType string    `json:"vehicle_type"` // 'moto' o 'car'
-	Type        string    `json:"type"`         // 'earning'
+	Type        string    `json:"type"`         // 'earning', 'redeem_*' (ver ledger.go / redemptions.go)
 	Amount      float64   `json:"points"`       // Cambiado de 'amount' a 'points' para el FE
 	Description string    `json:"description"`
+	LocationID  *string   `gorm:"type:uuid;index" json:"location_id,omitempty"` // Captura que originó el movimiento
 	CreatedAt   time.Time `json:"created_at"`
 }
 
 var db *gorm.DB
+var authVerifier *FirebaseVerifier
+var blobStore BlobStore
 
 func main() {
 	_ = godotenv.Load()
@@ -111,22 +138,85 @@ func main() {
 		log.Fatal("❌ Error DB:", err)
 	}
 
-	// 0. Asegurar PostGIS
-	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS postgis;").Error; err != nil {
-		log.Printf("⚠️ Warning PostGIS: %v", err)
+	// Subcomando: zonaflash-api migrate up [n] | down [n] | status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(os.Args[2:]); err != nil {
+			log.Fatal("❌ Error migración: ", err)
+		}
+		return
+	}
+	// Subcomando: zonaflash-api import <archivo> [--commit] | import rollback <id>
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImportCommand(os.Args[2:]); err != nil {
+			log.Fatal("❌ Error importación: ", err)
+		}
+		return
+	}
+	// Subcomando: zonaflash-api ledger reconcile [--fix]
+	if len(os.Args) > 1 && os.Args[1] == "ledger" {
+		if err := runLedgerCommand(os.Args[2:]); err != nil {
+			log.Fatal("❌ Error conciliación: ", err)
+		}
+		return
 	}
 
-	// Migración automática
-	db.AutoMigrate(&Vehicle{}, &Wallet{}, &Location{}, &Transaction{})
+	// Migraciones pendientes (advisory lock: solo una instancia migra a la vez)
+	if err := migrateUp(context.Background(), 0); err != nil {
+		log.Fatal("❌ Error migración: ", err)
+	}
+	seedSuperAdmins(db, os.Getenv("SUPER_ADMIN_UIDS"))
 
-	// Fix: Eliminar constraint de user_id si existe
-	db.Exec("ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_user_id_fkey;")
+	// Autenticación Firebase (ID tokens RS256)
+	projectID := os.Getenv("FIREBASE_PROJECT_ID")
+	if projectID == "" {
+		log.Fatal("❌ Error: FIREBASE_PROJECT_ID no configurada")
+	}
+	authVerifier = NewFirebaseVerifier(projectID, NewJWKSKeySource(firebaseJWKSURL))
 
-	// --- MIGRACIÓN DE DATOS ---
-	log.Println("🚀 Iniciando migración de datos para Status...")
-	db.Exec("UPDATE locations SET status = 'approved' WHERE status IS NULL OR status = 'pending';")
-	db.Exec("UPDATE offers SET status = 'active' WHERE status IS NULL;")
-	log.Println("✅ Migración completada.")
+	// Zona horaria de los cortes diarios (cuota de cazadores)
+	tzName := os.Getenv("APP_TIMEZONE")
+	if tzName == "" {
+		tzName = defaultAppTimezone
+	}
+	if appTimezone, err = time.LoadLocation(tzName); err != nil {
+		log.Fatal("❌ Error: APP_TIMEZONE inválida: ", tzName)
+	}
+
+	// PIN diario de estaciones
+	pinSecret := os.Getenv("PIN_SECRET")
+	if len(pinSecret) < 32 {
+		log.Fatal("❌ Error: PIN_SECRET no configurada (mínimo 32 caracteres)")
+	}
+	pinConfig.Secret = []byte(pinSecret)
+	if n, err := strconv.Atoi(os.Getenv("PIN_LENGTH")); err == nil {
+		if n < 4 || n > 9 {
+			log.Fatal("❌ Error: PIN_LENGTH debe estar entre 4 y 9")
+		}
+		pinConfig.Length = n
+	}
+
+	// Almacenamiento de fotos (un solo cliente para todo el proceso)
+	blobCfg := blobConfigFromEnv()
+	blobStore, err = newBlobStore(context.Background(), blobCfg)
+	if err != nil {
+		log.Fatal("❌ Error almacenamiento: ", err)
+	}
+	defer blobStore.Close()
+	log.Printf("🗄️ Almacenamiento de fotos: %s", blobCfg.Backend)
+	if n, err := strconv.ParseInt(os.Getenv("PHOTO_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		photoConfig.MaxBytes = n
+	}
+	if d, err := strconv.ParseFloat(os.Getenv("PHOTO_GPS_MAX_DISTANCE_M"), 64); err == nil && d > 0 {
+		photoConfig.GPSMaxDistanceM = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("PHOTO_HASH_MAX_DISTANCE")); err == nil && n >= 0 && n < photoHashBands*(maxPhotoHashRadius+1) {
+		photoConfig.HashMaxDistance = n
+	}
+
+	// Rotación programada de PINs a medianoche local de cada estación
+	startJob(context.Background(), "pin-rotation", time.Minute, rotateDuePINs)
+	// Ciclo de vida de ofertas flash: scheduled -> flash -> expired
+	startJob(context.Background(), "flash-offers", 30*time.Second, advanceFlashOffers)
 
 	r := gin.Default()
 
@@ -134,7 +224,8 @@ func main() {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-None-Match")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag, X-Next-Cursor")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -142,27 +233,80 @@ func main() {
 		c.Next()
 	})
 
+	if blobCfg.Backend == "local" {
+		r.Static("/media", blobCfg.LocalDir) // Sirve las fotos en desarrollo
+	}
+
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "online ⚡"})
 	})
 
 	// --- RUTAS ---
-	r.GET("/api/offers", getNearbyOffers)            // Buscar ofertas
-	r.POST("/api/vehicles", createVehicle)           // Guardar vehículo
-	r.GET("/api/vehicles/:user_id", getUserVehicles) // Consultar vehículos
-	r.POST("/api/vehicles/activate-with-pin", activateWithPIN)
-
-	r.GET("/api/wallet/:user_id", getWallet)
-	r.POST("/api/wallet/redeem", requestRedeem)
+	r.GET("/api/offers", getNearbyOffers)       // Buscar ofertas (público)
+	r.POST("/api/route-search", searchCorridor) // Lugares a lo largo de una ruta (público)
+	r.GET("/api/tiles/:z/:x/:y", getTile)       // Capa del mapa en MVT: /api/tiles/{z}/{x}/{y}.mvt (público)
+
+	// Rutas autenticadas: el UID sale del token, nunca del cliente
+	api := r.Group("/api", AuthRequired(authVerifier))
+	api.POST("/vehicles", createVehicle)           // Guardar vehículo
+	api.GET("/vehicles/:user_id", getUserVehicles) // Consultar vehículos
+	api.POST("/vehicles/activate-with-pin", activateWithPIN)
+
+	// Ofertas de comercios (station_admin de su propia Location)
+	api.GET("/offers/mine", listMyOffers)
+	api.POST("/offers", createOffer)
+	api.PUT("/offers/:id", updateOffer)
+	api.POST("/offers/:id/pause", pauseOffer)
+	api.POST("/offers/:id/resume", resumeOffer)
+	api.DELETE("/offers/:id", deleteOffer)
+	api.POST("/offers/:id/claim", claimOffer) // Consumir una unidad de stock flash
+
+	api.GET("/wallet/:user_id", getWallet)
+	api.POST("/wallet/redeem", requestRedeem)
+	api.GET("/wallet/redemptions", listMyRedemptions)
+	api.GET("/levels", listLevels)
 	// Hunter
-	r.POST("/api/hunter/submit", submitHuntHandler)
-	r.GET("/api/transactions/:user_id", getTransactions)
-
-	// Admin
-	r.GET("/api/admin/pending-vehicles", getPendingVehicles)
-	r.POST("/api/admin/approve-vehicle", approveVehicle)
-	r.GET("/api/admin/stations", getMapStations) // Ver todas las estaciones
-	r.POST("/api/admin/setup-b2b", setupB2B)     // Vincular socio a estación
+	api.POST("/hunter/submit", submitHuntHandler)
+	api.POST("/hunter/accept", acceptHunterInvite)
+	api.GET("/hunter/captures", listMyCaptures) // Resultado de moderación de mis capturas
+	api.GET("/transactions/:user_id", getTransactions)
+
+	// Admin (cada ruta exige su permiso)
+	admin := api.Group("/admin")
+	admin.GET("/pending-vehicles", RequirePermission(PermReviewVehicles), getPendingVehicles)
+	admin.POST("/approve-vehicle", RequirePermission(PermReviewVehicles), approveVehicle)
+	admin.GET("/stations", RequirePermission(PermViewStations), getMapStations) // Ver todas las estaciones
+	admin.POST("/setup-b2b", RequirePermission(PermSetupB2B), setupB2B)         // Vincular socio a estación
+	admin.POST("/stations/:id/rotate-pin", RequirePermission(PermRotatePIN), forceRotatePIN)
+	admin.GET("/locations", RequirePermission(PermModerateLocations), listLocationQueue)
+	admin.POST("/locations/:id/approve", RequirePermission(PermModerateLocations), approveLocation)
+	admin.POST("/locations/:id/reject", RequirePermission(PermModerateLocations), rejectLocation)
+	admin.GET("/locations/:id/photos", RequirePermission(PermModerateLocations), listLocationPhotos)
+	admin.POST("/imports", RequirePermission(PermImportLocations), importLocations)
+	admin.GET("/exports/:dataset", RequirePermission(PermExportData), exportData)
+	admin.GET("/imports", RequirePermission(PermImportLocations), listImports)
+	admin.POST("/imports/:id/rollback", RequirePermission(PermImportLocations), rollbackImportHandler)
+	admin.POST("/locations/merge", RequirePermission(PermMergeLocations), mergeLocationsHandler)
+	admin.GET("/location-merges", RequirePermission(PermMergeLocations), listMerges)
+	admin.POST("/location-merges/:id/split", RequirePermission(PermMergeLocations), splitMergeHandler)
+	admin.GET("/redemptions", RequirePermission(PermManageRedemptions), listRedemptions)
+	admin.POST("/redemptions/:id/approve", RequirePermission(PermManageRedemptions), approveRedemption)
+	admin.POST("/redemptions/:id/pay", RequirePermission(PermManageRedemptions), payRedemption)
+	admin.POST("/redemptions/:id/reject", RequirePermission(PermManageRedemptions), rejectRedemption)
+	admin.GET("/roles/:user_id", RequirePermission(PermManageRoles), listUserRoles)
+	admin.POST("/roles/grant", RequirePermission(PermManageRoles), grantRoleHandler)
+	admin.POST("/roles/revoke", RequirePermission(PermManageRoles), revokeRoleHandler)
+	admin.GET("/points-rules", RequirePermission(PermManagePoints), listPointsRules)
+	admin.POST("/points-rules", RequirePermission(PermManagePoints), createPointsRule)
+	admin.PUT("/points-rules/:id", RequirePermission(PermManagePoints), updatePointsRule)
+	admin.DELETE("/points-rules/:id", RequirePermission(PermManagePoints), deletePointsRule)
+	admin.POST("/levels", RequirePermission(PermManagePoints), createLevel)
+	admin.PUT("/levels/:id", RequirePermission(PermManagePoints), updateLevel)
+	admin.DELETE("/levels/:id", RequirePermission(PermManagePoints), deleteLevel)
+	admin.GET("/hunters", RequirePermission(PermManageHunters), listHunters)
+	admin.POST("/hunters/invite", RequirePermission(PermManageHunters), inviteHunter)
+	admin.POST("/hunters/:user_id/suspend", RequirePermission(PermManageHunters), suspendHunter)
+	admin.POST("/hunters/:user_id/activate", RequirePermission(PermManageHunters), activateHunter)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -188,6 +332,9 @@ func createVehicle(c *gin.Context) {
 		v.Status = "ACTIVE"
 		v.IsActive = true
 	}
+	v.UserID = currentUserID(c) // El dueño siempre es el usuario autenticado
+	v.Role = "driver"           // Rol y estación solo se asignan vía admin (setup-b2b)
+	v.StationID = ""
 	v.CreatedAt = time.Now()
 
 	// Guardar en DB
@@ -200,14 +347,23 @@ func createVehicle(c *gin.Context) {
 }
 
 func getUserVehicles(c *gin.Context) {
-	userID := c.Param("user_id")
+	userID, ok := requireSelf(c)
+	if !ok {
+		return
+	}
 	var vehicles []Vehicle
 	db.Where("user_id = ?", userID).Find(&vehicles)
+	roles, _ := loadUserRoles(db, userID)
 
 	// SEGURIDAD B2B: Si el usuario es station_admin, incluimos el PIN en el JSON de respuesta
 	// Usamos un mapa para la respuesta para poder inyectar campos dinámicos sin tocar el struct global
 	var response []map[string]interface{}
 	for _, v := range vehicles {
+		isStationAdmin := v.StationID != "" && stationAdminOf(roles, v.StationID)
+		role := RoleDriver
+		if isStationAdmin {
+			role = RoleStationAdmin
+		}
 		vMap := map[string]interface{}{
 			"id":         v.ID,
 			"user_id":    v.UserID,
@@ -215,14 +371,14 @@ func getUserVehicles(c *gin.Context) {
 			"brand":      v.Brand,
 			"model":      v.Model,
 			"status":     v.Status,
-			"role":       v.Role,
+			"role":       role,
 			"station_id": v.StationID,
 		}
 
-		if v.Role == "station_admin" && v.StationID != "" {
+		if isStationAdmin {
 			var loc Location
 			if err := db.First(&loc, "id = ?", v.StationID).Error; err == nil {
-				vMap["station_pin"] = ensureDailyPIN(&loc)
+				vMap["station_pin"] = currentStationPIN(&loc, time.Now())
 			}
 		}
 		response = append(response, vMap)
@@ -231,35 +387,18 @@ func getUserVehicles(c *gin.Context) {
 	c.JSON(200, response)
 }
 
-func ensureDailyPIN(loc *Location) string {
-	now := time.Now()
-	// Si el PIN no existe o es de un día distinto (Daily Reset)
-	if loc.DailyPIN == "" || loc.PINUpdatedAt.Year() != now.Year() || loc.PINUpdatedAt.YearDay() != now.YearDay() {
-		// Generación de 4 dígitos determinista pero fresca para el día
-		seed := now.UnixNano()
-		pin := fmt.Sprintf("%04d", seed%10000)
-		loc.DailyPIN = pin
-		loc.PINUpdatedAt = now
-		db.Model(loc).Updates(map[string]interface{}{
-			"daily_pin":      pin,
-			"pin_updated_at": now,
-		})
-	}
-	return loc.DailyPIN
-}
-
 func activateWithPIN(c *gin.Context) {
 	var req struct {
-		UserID string `json:"user_id"`
-		PIN    string `json:"pin"`
+		PIN string `json:"pin"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": "Faltan datos"})
 		return
 	}
+	userID := currentUserID(c)
 
 	var v Vehicle
-	if err := db.First(&v, "user_id = ?", req.UserID).Error; err != nil {
+	if err := db.First(&v, "user_id = ?", userID).Error; err != nil {
 		c.JSON(404, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
@@ -275,143 +414,169 @@ func activateWithPIN(c *gin.Context) {
 		return
 	}
 
-	currentPIN := ensureDailyPIN(&loc)
-	if req.PIN != currentPIN {
+	// Bloqueo por fuerza bruta (usuario o estación)
+	lockedUntil, err := pinLockedUntil(db, userID, loc.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando bloqueos"})
+		return
+	}
+	if time.Now().Before(lockedUntil) {
+		auditPINAttempt(db, userID, loc.ID, c.ClientIP(), "locked")
+		retry := int(time.Until(lockedUntil).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retry))
+		c.JSON(429, gin.H{"error": "Demasiados intentos. Intenta más tarde.", "retry_after_seconds": retry})
+		return
+	}
+
+	currentPIN := currentStationPIN(&loc, time.Now())
+	if !hmac.Equal([]byte(req.PIN), []byte(currentPIN)) {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := auditPINAttempt(tx, userID, loc.ID, c.ClientIP(), "wrong_pin"); err != nil {
+				return err
+			}
+			return registerPINFailure(tx, userID, loc.ID)
+		})
+		if err != nil {
+			log.Printf("❌ Error registrando intento de PIN: %v", err)
+		}
 		c.JSON(401, gin.H{"error": "PIN caducado o incorrecto. Pide el código del día a tu jefe de parada."})
 		return
 	}
 
 	// ACTIVACIÓN EXITOSA
-	v.Status = "ACTIVE"
-	db.Save(&v)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&v).Update("status", "ACTIVE").Error; err != nil {
+			return err
+		}
+		if err := resetPINFailures(tx, userID, loc.ID); err != nil {
+			return err
+		}
+		return auditPINAttempt(tx, userID, loc.ID, c.ClientIP(), "ok")
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error activando cuenta"})
+		return
+	}
 
 	c.JSON(200, gin.H{"message": "¡Activación exitosa! Bienvenido a la red.", "status": "ACTIVE"})
 }
 
+// getNearbyOffers: radio alrededor de lat/lng, bbox, polygon (GeoJSON) o miembros de un cluster.
+// Con mode=cluster devuelve grupos por celda en vez de puntos.
+// Paginación: limit (máx. 200) y cursor; el siguiente cursor viaja en la cabecera X-Next-Cursor.
 func getNearbyOffers(c *gin.Context) {
-	latStr := c.Query("lat")
-	lngStr := c.Query("lng")
-	radiusStr := c.Query("radius")
+	area, err := mapAreaFromQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
-	if latStr == "" || lngStr == "" {
-		c.JSON(400, gin.H{"error": "Faltan lat/lng"})
+	if c.Query("mode") == "cluster" {
+		clusterMapPoints(c, area)
 		return
 	}
 
-	lat, _ := strconv.ParseFloat(latStr, 64)
-	lng, _ := strconv.ParseFloat(lngStr, 64)
-	radius, _ := strconv.ParseFloat(radiusStr, 64)
-	if radius == 0 {
-		radius = 5000
+	limit := mapDefaultLimit
+	if l := c.Query("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 || limit > mapMaxLimit {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("limit debe estar entre 1 y %d", mapMaxLimit)})
+			return
+		}
+	}
+	var cursor *mapCursor
+	if cur := c.Query("cursor"); cur != "" {
+		if cursor, err = decodeMapCursor(cur); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	var offers []OfferResponse
 	// Consulta Geoespacial (UNION ALL entre Ofertas y Puntos Cazados)
+	points, args := mapPointsSQL(area)
 	query := `
-		(
-			SELECT 
-				id::text, 
-				title, 
-				description, 
-				price, 
-				category::text, -- Cast para el Enum de categoría
-				status::text,   -- Cast para el Enum de status (ESTE ES EL VITAL)
-				ST_Y(location::geometry) as latitude, 
-				ST_X(location::geometry) as longitude,
-				ST_Distance(location, ST_MakePoint(?, ?)::geography) as distance_meters
-			FROM offers
-			WHERE ST_DWithin(location, ST_MakePoint(?, ?)::geography, ?)
-		)
-		UNION ALL
-		(
-			SELECT 
-				id::text, 
-				shop_name as title, 
-				'' as description, 
-				0 as price, 
-				category,        -- Ya es texto
-				CASE 
-					WHEN category IN ('station_moto', 'station_car') AND (status IS NULL OR status = 'pending') THEN 'shadow'
-					WHEN status IS NULL OR status = '' THEN 'approved'
-					ELSE status 
-				END as status,   -- Aquí ya es texto
-				latitude, 
-				longitude,
-				ST_Distance(geom, ST_MakePoint(?, ?)::geography) as distance_meters
-			FROM locations
-			WHERE ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)
-		)
-		ORDER BY distance_meters ASC LIMIT 50;`
-
-	db.Raw(query, lng, lat, lng, lat, radius, lng, lat, lng, lat, radius).Scan(&offers)
+		SELECT * FROM (
+			SELECT id, title, description, price, category, status, latitude, longitude,
+				ST_Distance(geog, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography) AS distance_meters,
+				remaining_seconds, remaining_stock
+			FROM (` + points + `) p
+		) r`
+	args = append([]interface{}{area.centerLng, area.centerLat}, args...)
+	if cursor != nil {
+		query += " WHERE (distance_meters, id) > (?, ?)"
+		args = append(args, cursor.Distance, cursor.ID)
+	}
+	// Se pide uno extra para saber si hay página siguiente
+	query += " ORDER BY distance_meters ASC, id ASC LIMIT ?"
+	args = append(args, limit+1)
+
+	if err := db.Raw(query, args...).Scan(&offers).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando el mapa"})
+		return
+	}
+	if len(offers) > limit {
+		offers = offers[:limit]
+		last := offers[limit-1]
+		c.Header("X-Next-Cursor", encodeMapCursor(mapCursor{Distance: last.Distance, ID: last.ID}))
+	}
+	if wantsGeoJSON(c) {
+		writeGeoJSON(c, offerFeatures(offers))
+		return
+	}
 	c.JSON(200, offers)
 }
 
 func getWallet(c *gin.Context) {
-	userID := c.Param("user_id")
+	userID, ok := requireSelf(c)
+	if !ok {
+		return
+	}
 	var wallet Wallet
 
 	// Buscar billetera, si no existe, crearla
-	if result := db.First(&wallet, "user_id = ?", userID); result.Error != nil {
-		wallet = Wallet{
-			UserID:         userID,
-			BalanceMoto:    0,
-			BalanceCar:     0,
-			LifetimePoints: 0,
-			Goal:           500,
-			Status:         "active",
-			LevelName:      "Novato",
-		}
-		db.Create(&wallet)
-	}
-	c.JSON(200, wallet)
-}
-
-func requestRedeem(c *gin.Context) {
-	var req struct {
-		UserID      string `json:"user_id"`
-		VehicleType string `json:"vehicle_type"` // 'moto' o 'car'
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": "Falta datos (user_id/vehicle_type)"})
+	if err := ensureWallet(db, userID); err != nil {
+		c.JSON(500, gin.H{"error": "Error creando billetera"})
 		return
 	}
-
-	var wallet Wallet
-	if err := db.First(&wallet, "user_id = ?", req.UserID).Error; err != nil {
-		c.JSON(404, gin.H{"error": "Wallet no encontrada"})
+	if err := db.First(&wallet, "user_id = ?", userID).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando billetera"})
 		return
 	}
 
-	currentBalance := wallet.BalanceMoto
-	if req.VehicleType == "car" {
-		currentBalance = wallet.BalanceCar
-	}
-
-	if currentBalance < wallet.Goal {
-		c.JSON(400, gin.H{"error": "Saldo insuficiente en el modo seleccionado"})
+	// Avance hacia el siguiente nivel
+	levels, err := loadLevels(db)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando niveles"})
 		return
 	}
-
-	// Actualizar estado
-	wallet.Status = "pending"
-	db.Save(&wallet)
-
-	c.JSON(200, gin.H{"message": "Solicitud recibida", "new_status": "pending"})
+	c.JSON(200, struct {
+		Wallet
+		LevelProgress LevelProgress `json:"level_progress"`
+	}{wallet, levelProgress(levels, &wallet)})
 }
 
-var authorizedUIDs = map[string]bool{
-	"wkq951i7vvhJbrZOQmUav6B28BZ2": true, // Admin 1
-	"DtfBh0Tr41fyjUwtcbl9WCBpgOJ2": true, // Usuario actual
+// Validación estricta de categorías de producción
+var huntCategories = map[string]bool{
+	"station_moto": true,
+	"station_car":  true,
+	"mechanic":     true,
+	"parts":        true,
+	"tires":        true,
+	"oil":          true,
+	"wash":         true,
+	"tow":          true,
+	"food":         true,
+	"fuel_dollar":  true,
 }
 
 func submitHuntHandler(c *gin.Context) {
 	// Ya no usamos JSON binding para este endpoint
 
 	// --- SEGURIDAD DE PRODUCCIÓN ---
-	// Como es multipart/form-data, leemos los campos uno por uno
-	userID := c.PostForm("user_id")
-	if !authorizedUIDs[userID] {
+	// El UID viene del token verificado, no del formulario
+	userID := currentUserID(c)
+	hunter, err := findHunter(db, userID)
+	if err != nil || hunter.Status != HunterActive {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Usuario no autorizado para capturas"})
 		return
 	}
@@ -425,116 +590,165 @@ func submitHuntHandler(c *gin.Context) {
 	activationStatus := c.PostForm("activation_status")
 	assetType := c.PostForm("asset_type")
 
-	lat, _ := strconv.ParseFloat(latStr, 64)
-	lng, _ := strconv.ParseFloat(lngStr, 64)
+	lat, errLat := strconv.ParseFloat(latStr, 64)
+	lng, errLng := strconv.ParseFloat(lngStr, 64)
+	if errLat != nil || errLng != nil || !validCoords(lat, lng) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Coordenadas inválidas (latitude/longitude)"})
+		return
+	}
 
 	// 2. Validación estricta de categorías de producción
-	allowedCategories := map[string]bool{
-		"station_moto": true,
-		"station_car":  true,
-		"mechanic":     true,
-		"parts":        true,
-		"tires":        true,
-		"oil":          true,
-		"wash":         true,
-		"tow":          true,
-		"food":         true,
-		"fuel_dollar":  true,
-	}
-	if !allowedCategories[category] {
+	if !huntCategories[category] {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Categoría no permitida: " + category})
 		return
 	}
+	if !hunter.canCapture(category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para capturar: " + category})
+		return
+	}
 
-	// 0. PROXIMITY CHECK (Anti-Duplicado) - 20 metros
-	var count int64
-	checkQuery := `
-		SELECT count(*) 
-		FROM locations 
-		WHERE category = ? 
-		AND ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, 20)`
-	db.Raw(checkQuery, category, lng, lat).Scan(&count)
-
-	if count > 0 {
-		c.JSON(http.StatusConflict, gin.H{"error": "Este punto ya ha sido capturado recientemente"})
-		return
-	}
-	// --- INICIALIZACIÓN DE GCS NIVEL SENIOR (Transporte Manual) ---
-	photoUrl := ""
-	file, err := c.FormFile("photo")
-	if err == nil {
-		ctx := context.Background()
-		var client *storage.Client
-
-		// 1. Leemos el archivo físico del Secret File
-		data, errFile := os.ReadFile("firebase-key.json")
-		if errFile != nil {
-			log.Printf("❌ Error leyendo firebase-key.json: %v", errFile)
-		} else {
-			// 2. Creamos la identidad aislada
-			creds, errCreds := google.CredentialsFromJSON(ctx, data, storage.ScopeFullControl)
-			if errCreds != nil {
-				log.Printf("❌ Error procesando credenciales: %v", errCreds)
-			} else {
-				// 3. CREAMOS UN CLIENTE HTTP YA AUTENTICADO
-				// Esto evita que el SDK de Storage intente autenticarse por su cuenta
-				hc, _, errTransport := transport.NewHTTPClient(ctx, option.WithCredentials(creds))
-				if errTransport != nil {
-					log.Printf("❌ Error creando transporte HTTP: %v", errTransport)
-				} else {
-					// 4. INICIALIZAMOS EL CLIENTE USANDO EL TRANSPORTE Y ANULANDO AUTH AUTOMÁTICA
-					// El option.WithoutAuthentication() le dice al SDK: 'No busques llaves, usa el túnel hc'
-					client, err = storage.NewClient(ctx, option.WithHTTPClient(hc), option.WithoutAuthentication())
-				}
+	// 2.1 Cuota diaria del cazador
+	if hunter.DailyQuota > 0 {
+		done, err := capturesToday(db, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Error consultando cuota"})
+			return
+		}
+		if done >= int64(hunter.DailyQuota) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Cuota diaria de capturas alcanzada"})
+			return
+		}
+	}
+
+	// 0. Posible duplicado (nombre + distancia + familia de categoría).
+	// El cazador puede reenviar con confirm_duplicate=true si está seguro de que es otro negocio.
+	confirmDuplicate := c.PostForm("confirm_duplicate") == "true"
+	dup, err := findPossibleDuplicate(db, shopName, category, lat, lng)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error verificando duplicados"})
+		return
+	}
+	if dup != nil && !confirmDuplicate {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":              "Posible duplicado de " + dup.ShopName,
+			"possible_duplicate": dup,
+			"can_confirm":        true, // Reenviar con confirm_duplicate=true
+		})
+		return
+	}
+	// 1. Foto (opcional). Se valida el contenido real, se quita el EXIF y se generan miniaturas.
+	// Si viene y no se puede guardar, la captura no se registra.
+	var photo *processedPhoto
+	photoUrls := map[string]string{}
+	var photoKeys []string
+	committed := false
+	defer func() {
+		// Si la captura no llega a guardarse, no dejamos fotos huérfanas
+		if !committed {
+			for _, key := range photoKeys {
+				blobStore.Delete(context.Background(), key)
 			}
 		}
+	}()
+	if file, err := c.FormFile("photo"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo leer la foto"})
+			return
+		}
+		defer f.Close()
 
-		// Validación de seguridad
-		if err != nil || client == nil {
-			log.Printf("❌ Error final creando cliente GCS: %v", err)
-		} else {
-			defer client.Close()
-
-			bucketName := "chatcerex-v4-post-images"
-			objectName := fmt.Sprintf("zona_flash/captures/%s/%d.jpg", userID, time.Now().Unix())
-
-			f, openErr := file.Open()
-			if openErr != nil {
-				log.Printf("❌ Error abriendo archivo: %v", openErr)
-			} else {
-				defer f.Close()
-
-				wc := client.Bucket(bucketName).Object(objectName).NewWriter(ctx)
-				wc.ContentType = "image/jpeg"
-
-				if _, err = io.Copy(wc, f); err != nil {
-					log.Printf("❌ Error copiando a GCS: %v", err)
-				}
-				if err := wc.Close(); err != nil {
-					log.Printf("❌ Error cerrando GCS writer: %v", err)
-				} else {
-					photoUrl = fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucketName, objectName)
-					log.Printf("✅ FOTO SUBIDA EXITOSAMENTE: %s", photoUrl)
-				}
+		data, err := readPhoto(f)
+		if err == nil {
+			photo, err = processPhoto(data)
+		}
+		if err != nil {
+			code, msg := photoErrorStatus(err)
+			c.JSON(code, gin.H{"error": msg})
+			return
+		}
+
+		base := fmt.Sprintf("zona_flash/captures/%s/%d", userID, time.Now().Unix())
+		renditions := []struct {
+			name, suffix string
+			data         []byte
+		}{
+			{"original", ".jpg", photo.Original},
+			{"medium", "_medium.jpg", photo.Medium},
+			{"thumb", "_thumb.jpg", photo.Thumb},
+		}
+		for _, r := range renditions {
+			key := base + r.suffix
+			url, err := blobStore.Put(c.Request.Context(), key, bytes.NewReader(r.data), "image/jpeg")
+			if err != nil {
+				log.Printf("❌ Error subiendo foto (%s): %v", r.name, err)
+				c.JSON(http.StatusBadGateway, gin.H{"error": "No se pudo guardar la foto. Intenta de nuevo."})
+				return
 			}
+			photoKeys = append(photoKeys, key)
+			photoUrls[r.name] = url
+		}
+		log.Printf("✅ FOTO SUBIDA EXITOSAMENTE: %s", photoUrls["original"])
+	}
+
+	// 1.1 GPS del EXIF vs coordenadas enviadas: no bloquea, marca la captura para moderación
+	var gpsDistance *float64
+	gpsMismatch := false
+	if photo != nil && photo.GPS != nil {
+		d := haversineMeters(lat, lng, photo.GPS.Lat, photo.GPS.Lng)
+		gpsDistance = &d
+		gpsMismatch = d > photoConfig.GPSMaxDistanceM
+		if gpsMismatch {
+			log.Printf("⚠️ Captura de %s: GPS de la foto a %.0f m del punto enviado", userID, d)
 		}
 	}
 
+	// 1.2 Foto repetida (hash perceptual): tampoco bloquea, la marca para moderación
+	var photoHash *int64
+	var duplicateOf *string
+	var hashDistance *int
+	if photo != nil {
+		photoHash = &photo.Hash
+		id, dist, dup, err := similarPhoto(db, photo.Hash)
+		if err != nil {
+			log.Printf("❌ Error buscando fotos similares: %v", err)
+		} else if dup {
+			duplicateOf, hashDistance = &id, &dist
+			log.Printf("⚠️ Captura de %s: foto casi idéntica a %s (distancia %d)", userID, id, dist)
+		}
+	}
+
+	var possibleDuplicateOf *string
+	var duplicateScore *float64
+	if dup != nil {
+		possibleDuplicateOf, duplicateScore = &dup.ID, &dup.Score
+		log.Printf("⚠️ Captura de %s confirmada pese a posible duplicado de %s (%.2f)", userID, dup.ID, dup.Score)
+	}
+
 	tx := db.Begin()
 
 	// 2. Insert Location
 	loc := Location{
-		UserID:           userID,
-		VehicleType:      vehicleType,
-		ShopName:         shopName,
-		Category:         category,
-		PhotoURL:         photoUrl,
-		Latitude:         lat,
-		Longitude:        lng,
-		Status:           "pending",
-		IsShadow:         isShadow,
-		ActivationStatus: activationStatus,
-		AssetType:        assetType,
+		UserID:              userID,
+		VehicleType:         vehicleType,
+		ShopName:            shopName,
+		Category:            category,
+		PhotoURL:            photoUrls["original"],
+		ThumbURL:            photoUrls["thumb"],
+		MediumURL:           photoUrls["medium"],
+		PhotoGPSDistance:    gpsDistance,
+		GPSMismatch:         gpsMismatch,
+		PhotoHash:           photoHash,
+		DuplicatePhotoOf:    duplicateOf,
+		PhotoHashDistance:   hashDistance,
+		PossibleDuplicateOf: possibleDuplicateOf,
+		DuplicateScore:      duplicateScore,
+		Latitude:            lat,
+		Longitude:           lng,
+		Status:              "pending",
+		IsShadow:            isShadow,
+		ActivationStatus:    activationStatus,
+		AssetType:           assetType,
 	}
 
 	// 1.1 Poblar Geom manualmente para PostGIS
@@ -551,71 +765,69 @@ func submitHuntHandler(c *gin.Context) {
 		return
 	}
 
-	// 3. Insert Transaction
-	trans := Transaction{
-		UserID:      userID,
+	// 3. Puntos según las reglas configuradas (zona, categoría, franja, foto...)
+	award, err := capturePoints(tx, &captureContext{
+		LocationID:  loc.ID,
+		Category:    category,
 		VehicleType: vehicleType,
-		Amount:      10,
-		Description: "Captura de negocio: " + shopName,
-		CreatedAt:   time.Now(),
-	}
-	if err := tx.Create(&trans).Error; err != nil {
+		Lat:         lat,
+		Lng:         lng,
+		At:          time.Now(),
+		Photo:       photo,
+		GPSMismatch: gpsMismatch,
+		PhotoRepeat: duplicateOf != nil,
+	})
+	if err != nil {
 		tx.Rollback()
-		c.JSON(500, gin.H{"error": "Error creating transaction"})
+		log.Printf("❌ Error calculando puntos: %v", err)
+		c.JSON(500, gin.H{"error": "Error calculando puntos"})
 		return
 	}
 
-	// 3. Upsert Wallet
-	// Raw SQL para asegurar que el constraint no bloquee (MVP)
-	tx.Exec("SET CONSTRAINTS ALL DEFERRED")
-
-	// Usamos raw SQL para upsert atómico y sencillo
-	// Determinamos qué balance actualizar según el vehicle_type
-	balanceCol := "balance_moto"
-	if vehicleType == "car" {
-		balanceCol = "balance_car"
-	}
-
-	upsertWallet := `
-        INSERT INTO wallets (user_id, balance_moto, balance_car, lifetime_points, goal, status, level_name) 
-        VALUES (?, ?, ?, 10, 500, 'active', 'Novato') 
-        ON CONFLICT (user_id) 
-        DO UPDATE SET ` + balanceCol + ` = wallets.` + balanceCol + ` + 10, lifetime_points = wallets.lifetime_points + 10
-    `
-
-	balanceMotoInit := 0.0
-	balanceCarInit := 0.0
-	if vehicleType == "car" {
-		balanceCarInit = 10.0
-	} else {
-		balanceMotoInit = 10.0
-	}
-
-	if err := tx.Exec(upsertWallet, userID, balanceMotoInit, balanceCarInit).Error; err != nil {
-		tx.Rollback()
-		c.JSON(500, gin.H{"error": "Error updating wallet"})
-		return
+	// 3.1 Asiento en el libro mayor (Transaction + proyección en Wallet)
+	// (si las reglas dejan la captura en cero no hay nada que asentar)
+	if award.Total > 0 {
+		if _, err := postPoints(tx, Posting{
+			UserID:      userID,
+			VehicleType: vehicleType,
+			Type:        TxEarning,
+			Description: "Captura de negocio: " + shopName,
+			LocationID:  loc.ID,
+			Debit:       AcctRewards,
+			Credit:      userAccount(userID, vehicleType),
+			Amount:      award.Total,
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(500, gin.H{"error": "Error updating wallet"})
+			return
+		}
 	}
 
 	if err := tx.Commit().Error; err != nil {
 		log.Printf("❌ Error al hacer COMMIT: %v", err)
-	} else {
-		log.Printf("✅ Transacción COMMIT exitosa para User: %s", userID)
+		c.JSON(500, gin.H{"error": "Error guardando captura"})
+		return
 	}
+	committed = true
+	log.Printf("✅ Transacción COMMIT exitosa para User: %s (%.2f pts)", userID, award.Total)
 
 	// 5. Return updated wallet for instant FE sync
 	var updatedWallet Wallet
 	db.First(&updatedWallet, "user_id = ?", userID)
 
 	c.JSON(200, gin.H{
-		"message": "Hunt submitted successfully",
-		"points":  10,
-		"wallet":  updatedWallet,
+		"message":      "Hunt submitted successfully",
+		"points":       award.Total,
+		"points_rules": award.Rules, // Qué reglas se aplicaron y cuánto aportó cada una
+		"wallet":       updatedWallet,
 	})
 }
 
 func getTransactions(c *gin.Context) {
-	userID := c.Param("user_id")
+	userID, ok := requireSelf(c)
+	if !ok {
+		return
+	}
 	vehicleType := c.Query("vehicle_type") // Opcional: moto o car
 
 	var transactions []Transaction
@@ -677,9 +889,19 @@ func approveVehicle(c *gin.Context) {
 }
 
 func getMapStations(c *gin.Context) {
-	var stations []Location
-	// Solo estaciones reales
-	db.Where("category IN ?", []string{"station_moto", "station_car"}).Find(&stations)
+	stations := []PublicStation{}
+	// Solo estaciones reales, y solo sus campos públicos
+	if err := db.Model(&Location{}).
+		Select("id, shop_name, category, status, photo_url, thumb_url, timezone, latitude, longitude").
+		Where("category IN ? AND status IS DISTINCT FROM ?", []string{"station_moto", "station_car"}, LocationMerged).
+		Scan(&stations).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando estaciones"})
+		return
+	}
+	if wantsGeoJSON(c) {
+		writeGeoJSON(c, stationFeatures(stations))
+		return
+	}
 	c.JSON(http.StatusOK, stations)
 }
 
@@ -688,7 +910,8 @@ func setupB2B(c *gin.Context) {
 		UserID       string `json:"user_id"`
 		StationID    string `json:"station_id"`
 		OfficialName string `json:"official_name"`
-		Role         string `json:"role"` // 'driver' o 'station_admin'
+		Role         string `json:"role"`     // 'driver' o 'station_admin'
+		Timezone     string `json:"timezone"` // Opcional: zona IANA de la estación
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -696,6 +919,21 @@ func setupB2B(c *gin.Context) {
 		return
 	}
 
+	if req.Role != RoleDriver && req.Role != RoleStationAdmin {
+		c.JSON(400, gin.H{"error": "Rol inválido: " + req.Role})
+		return
+	}
+	if req.Role == RoleStationAdmin && req.StationID == "" {
+		c.JSON(400, gin.H{"error": "station_admin requiere station_id"})
+		return
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			c.JSON(400, gin.H{"error": "Zona horaria inválida: " + req.Timezone})
+			return
+		}
+	}
+
 	tx := db.Begin()
 
 	// 1. Actualizar Rol y Estación en el vehículo
@@ -709,12 +947,29 @@ func setupB2B(c *gin.Context) {
 		return
 	}
 
+	// 1.1 Persistir el rol (fuente de verdad de autorización)
+	var roleErr error
+	if req.Role == RoleStationAdmin {
+		roleErr = grantRole(tx, req.UserID, RoleStationAdmin, req.StationID, currentUserID(c))
+	} else {
+		_, roleErr = revokeRole(tx, req.UserID, RoleStationAdmin, "")
+	}
+	if roleErr != nil {
+		tx.Rollback()
+		c.JSON(500, gin.H{"error": "Error al actualizar rol"})
+		return
+	}
+
 	// 2. Si se vincula a una estación, actualizar la estación
 	if req.StationID != "" {
-		if err := tx.Model(&Location{}).Where("id = ?", req.StationID).Updates(map[string]interface{}{
+		updates := map[string]interface{}{
 			"shop_name": req.OfficialName,
 			"status":    "approved", // Activamos la parada en el mapa
-		}).Error; err != nil {
+		}
+		if req.Timezone != "" {
+			updates["timezone"] = req.Timezone
+		}
+		if err := tx.Model(&Location{}).Where("id = ?", req.StationID).Updates(updates).Error; err != nil {
 			tx.Rollback()
 			c.JSON(500, gin.H{"error": "Error al actualizar estación"})
 			return
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- BÚSQUEDA EN EL MAPA (Áreas y agrupación) ---
+
+// mapArea filtro espacial común a ofertas y capturas.
+// 'cond' usa {col} en lugar de la columna geography de cada tabla.
+type mapArea struct {
+	cond      string
+	args      []interface{}
+	centerLat float64 // Referencia para distance_meters
+	centerLng float64
+}
+
+func radiusArea(lat, lng, radius float64) mapArea {
+	return mapArea{
+		cond:      "ST_DWithin({col}, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)",
+		args:      []interface{}{lng, lat, radius},
+		centerLat: lat,
+		centerLng: lng,
+	}
+}
+
+// envelopeArea rectángulo en Web Mercator (celdas de cluster)
+func envelopeArea(minX, minY, maxX, maxY float64) mapArea {
+	lat, lng := mercatorToLatLng((minX+maxX)/2, (minY+maxY)/2)
+	return mapArea{
+		cond:      "ST_Intersects({col}, ST_Transform(ST_MakeEnvelope(?, ?, ?, ?, 3857), 4326)::geography)",
+		args:      []interface{}{minX, minY, maxX, maxY},
+		centerLat: lat,
+		centerLng: lng,
+	}
+}
+
+// bboxArea rectángulo del viewport en grados
+func bboxArea(minLng, minLat, maxLng, maxLat float64) mapArea {
+	return mapArea{
+		cond:      "ST_Intersects({col}, ST_MakeEnvelope(?, ?, ?, ?, 4326)::geography)",
+		args:      []interface{}{minLng, minLat, maxLng, maxLat},
+		centerLat: (minLat + maxLat) / 2,
+		centerLng: (minLng + maxLng) / 2,
+	}
+}
+
+// polygonArea polígono GeoJSON ya validado
+func polygonArea(geojson string, centerLat, centerLng float64) mapArea {
+	return mapArea{
+		cond:      "ST_Intersects({col}, ST_SetSRID(ST_GeomFromGeoJSON(?), 4326)::geography)",
+		args:      []interface{}{geojson},
+		centerLat: centerLat,
+		centerLng: centerLng,
+	}
+}
+
+const (
+	mapDefaultRadius   = 5000
+	mapMaxRadius       = 50000
+	mapMaxPolygonVerts = 1000
+	mapDefaultLimit    = 50
+	mapMaxLimit        = 200
+)
+
+var errBadCoords = errors.New("coordenadas inválidas")
+
+// queryFloat lee un número obligatorio; a diferencia de antes, un valor mal formado es error (no 0)
+func queryFloat(c *gin.Context, name string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(c.Query(name)), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%s inválido", name)
+	}
+	return v, nil
+}
+
+// parseBBox "minLng,minLat,maxLng,maxLat"
+func parseBBox(raw string) (mapArea, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return mapArea{}, errors.New("bbox debe ser minLng,minLat,maxLng,maxLat")
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return mapArea{}, errors.New("bbox debe ser minLng,minLat,maxLng,maxLat")
+		}
+		v[i] = f
+	}
+	minLng, minLat, maxLng, maxLat := v[0], v[1], v[2], v[3]
+	if minLng < -180 || maxLng > 180 || minLat < -90 || maxLat > 90 || minLng >= maxLng || minLat >= maxLat {
+		return mapArea{}, errors.New("bbox fuera de rango o invertido")
+	}
+	return bboxArea(minLng, minLat, maxLng, maxLat), nil
+}
+
+// parsePolygon acepta una geometría GeoJSON Polygon (o un Feature que la contenga)
+func parsePolygon(raw string) (mapArea, error) {
+	var geom struct {
+		Type        string          `json:"type"`
+		Coordinates [][][]float64   `json:"coordinates"`
+		Geometry    json.RawMessage `json:"geometry"`
+	}
+	if err := json.Unmarshal([]byte(raw), &geom); err != nil {
+		return mapArea{}, errors.New("polygon no es GeoJSON válido")
+	}
+	if geom.Type == "Feature" {
+		return parsePolygon(string(geom.Geometry))
+	}
+	if geom.Type != "Polygon" || len(geom.Coordinates) == 0 {
+		return mapArea{}, errors.New("polygon debe ser un GeoJSON de tipo Polygon")
+	}
+
+	verts := 0
+	for _, ring := range geom.Coordinates {
+		if len(ring) < 4 {
+			return mapArea{}, errors.New("cada anillo del polygon necesita al menos 4 posiciones")
+		}
+		first, last := ring[0], ring[len(ring)-1]
+		if len(first) < 2 || len(last) < 2 || first[0] != last[0] || first[1] != last[1] {
+			return mapArea{}, errors.New("los anillos del polygon deben cerrarse")
+		}
+		for _, pos := range ring {
+			if len(pos) < 2 || pos[0] < -180 || pos[0] > 180 || pos[1] < -90 || pos[1] > 90 {
+				return mapArea{}, errBadCoords
+			}
+		}
+		verts += len(ring)
+	}
+	if verts > mapMaxPolygonVerts {
+		return mapArea{}, fmt.Errorf("polygon admite hasta %d vértices", mapMaxPolygonVerts)
+	}
+
+	// Solo la geometría (sin Feature ni propiedades) llega a PostGIS
+	clean, _ := json.Marshal(map[string]interface{}{"type": "Polygon", "coordinates": geom.Coordinates})
+	outer := geom.Coordinates[0][:len(geom.Coordinates[0])-1]
+	var lat, lng float64
+	for _, pos := range outer {
+		lng += pos[0]
+		lat += pos[1]
+	}
+	return polygonArea(string(clean), lat/float64(len(outer)), lng/float64(len(outer))), nil
+}
+
+// mapAreaFromQuery elige el área: cluster, bbox, polygon o radio (lat/lng/radius).
+// Con bbox/polygon, lat/lng son opcionales y solo fijan el punto desde el que se mide distance_meters.
+func mapAreaFromQuery(c *gin.Context) (mapArea, error) {
+	var area mapArea
+	var err error
+	switch {
+	case c.Query("cluster") != "":
+		var ok bool
+		if area, ok = parseClusterID(c.Query("cluster")); !ok {
+			return area, errors.New("cluster inválido")
+		}
+	case c.Query("bbox") != "":
+		area, err = parseBBox(c.Query("bbox"))
+	case c.Query("polygon") != "":
+		area, err = parsePolygon(c.Query("polygon"))
+	default:
+		if c.Query("lat") == "" || c.Query("lng") == "" {
+			return area, errors.New("Faltan lat/lng (o bbox / polygon)")
+		}
+		radius := float64(mapDefaultRadius)
+		if c.Query("radius") != "" {
+			if radius, err = queryFloat(c, "radius"); err != nil {
+				return area, err
+			}
+			if radius <= 0 || radius > mapMaxRadius {
+				return area, fmt.Errorf("radius debe estar entre 1 y %d metros", mapMaxRadius)
+			}
+		}
+		lat, lng, err := queryLatLng(c)
+		if err != nil {
+			return area, err
+		}
+		return radiusArea(lat, lng, radius), nil
+	}
+	if err != nil {
+		return area, err
+	}
+
+	if c.Query("lat") != "" || c.Query("lng") != "" {
+		lat, lng, err := queryLatLng(c)
+		if err != nil {
+			return area, err
+		}
+		area.centerLat, area.centerLng = lat, lng
+	}
+	return area, nil
+}
+
+func queryLatLng(c *gin.Context) (float64, float64, error) {
+	lat, err := queryFloat(c, "lat")
+	if err != nil {
+		return 0, 0, err
+	}
+	lng, err := queryFloat(c, "lng")
+	if err != nil {
+		return 0, 0, err
+	}
+	if !validCoords(lat, lng) {
+		return 0, 0, errBadCoords
+	}
+	return lat, lng, nil
+}
+
+// --- PAGINACIÓN POR CURSOR ---
+//
+// Orden estable (distance_meters, id): el cursor guarda la última pareja devuelta.
+
+type mapCursor struct {
+	Distance float64 `json:"d"`
+	ID       string  `json:"i"`
+}
+
+func encodeMapCursor(cur mapCursor) string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeMapCursor(s string) (*mapCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("cursor inválido")
+	}
+	var cur mapCursor
+	if err := json.Unmarshal(raw, &cur); err != nil || cur.ID == "" {
+		return nil, errors.New("cursor inválido")
+	}
+	return &cur, nil
+}
+
+// mapPointsSQL ofertas visibles + capturas del mapa dentro del área (misma forma para ambas)
+func mapPointsSQL(a mapArea) (string, []interface{}) {
+	query := `
+		SELECT
+			id::text AS id,
+			title,
+			description,
+			price,
+			category::text AS category, -- Cast para el Enum de categoría
+			status::text AS status,     -- Cast para el Enum de status
+			ST_Y(location::geometry) AS latitude,
+			ST_X(location::geometry) AS longitude,
+			location AS geog,
+			GREATEST(EXTRACT(EPOCH FROM ends_at - NOW()), 0)::bigint AS remaining_seconds,
+			stock_remaining AS remaining_stock
+		FROM offers
+		WHERE ` + strings.ReplaceAll(a.cond, "{col}", "location") + `
+		AND status::text NOT IN ('paused', 'scheduled', 'expired') -- Fuera del mapa
+		AND (ends_at IS NULL OR ends_at > NOW()) -- Aunque el job aún no las haya expirado
+		UNION ALL
+		SELECT
+			id::text,
+			shop_name,
+			'',
+			0,
+			category,
+			CASE
+				WHEN category IN ('station_moto', 'station_car') AND (status IS NULL OR status = 'pending') THEN 'shadow'
+				WHEN status IS NULL OR status = '' THEN 'approved'
+				ELSE status
+			END,
+			latitude,
+			longitude,
+			geom,
+			NULL::bigint,
+			NULL::bigint
+		FROM locations
+		WHERE ` + strings.ReplaceAll(a.cond, "{col}", "geom") + `
+		AND status IS DISTINCT FROM 'rejected' -- Descartadas en moderación
+		AND status IS DISTINCT FROM 'merged'   -- Absorbidas por otra captura`
+	args := append(append([]interface{}{}, a.args...), a.args...)
+	return query, args
+}
+
+// --- CLUSTERS (zoom bajo) ---
+
+const (
+	mercatorWorld  = 2 * math.Pi * 6378137 // Ancho del mundo en metros Web Mercator
+	clusterCellPx  = 80                    // Tamaño de la celda en píxeles de pantalla
+	clusterMaxZoom = 22
+)
+
+// clusterCellSize lado de la celda en metros Mercator para el zoom dado (tiles de 256 px).
+// Grid fijo en vez de ST_ClusterKMeans: las celdas son estables entre peticiones y permiten drill-down.
+func clusterCellSize(zoom int) float64 {
+	return mercatorWorld / (256 * math.Exp2(float64(zoom))) * clusterCellPx
+}
+
+func mercatorToLatLng(x, y float64) (lat, lng float64) {
+	lng = x / 6378137 * 180 / math.Pi
+	lat = (2*math.Atan(math.Exp(y/6378137)) - math.Pi/2) * 180 / math.Pi
+	return lat, lng
+}
+
+// MapCluster grupo de puntos de una celda
+type MapCluster struct {
+	ID            string         `json:"id"` // "zoom/gx/gy": se pasa como cluster=... para ver los miembros
+	Count         int            `json:"count"`
+	Latitude      float64        `json:"latitude"` // Centroide de los miembros
+	Longitude     float64        `json:"longitude"`
+	Bounds        [4]float64     `json:"bounds"` // minLng, minLat, maxLng, maxLat
+	ByCategory    map[string]int `json:"by_category"`
+	ByStatus      map[string]int `json:"by_status"`
+	ExpansionZoom int            `json:"expansion_zoom"` // Zoom al que el cluster se separa
+}
+
+// parseClusterID "zoom/gx/gy" -> área de la celda
+func parseClusterID(id string) (mapArea, bool) {
+	parts := strings.Split(id, "/")
+	if len(parts) != 3 {
+		return mapArea{}, false
+	}
+	zoom, err1 := strconv.Atoi(parts[0])
+	gx, err2 := strconv.ParseInt(parts[1], 10, 64)
+	gy, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || zoom < 0 || zoom > clusterMaxZoom {
+		return mapArea{}, false
+	}
+	cell := clusterCellSize(zoom)
+	return envelopeArea(float64(gx)*cell, float64(gy)*cell, float64(gx+1)*cell, float64(gy+1)*cell), true
+}
+
+// clusterMapPoints agrupa los puntos del área en celdas según el zoom
+func clusterMapPoints(c *gin.Context, area mapArea) {
+	zoom, err := strconv.Atoi(c.Query("zoom"))
+	if err != nil || zoom < 0 || zoom > clusterMaxZoom {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("zoom debe estar entre 0 y %d", clusterMaxZoom)})
+		return
+	}
+	cell := clusterCellSize(zoom)
+
+	points, args := mapPointsSQL(area)
+	var rows []struct {
+		GX, GY           int64
+		Category, Status string
+		N                int
+		SumLat, SumLng   float64
+		MinLat, MinLng   float64
+		MaxLat, MaxLng   float64
+	}
+	// Se agrupa por celda + categoría + estado en SQL; los totales por celda se arman aquí
+	query := `
+		WITH p AS (` + points + `), m AS (
+			SELECT *, ST_Transform(geog::geometry, 3857) AS merc FROM p
+		)
+		SELECT
+			floor(ST_X(merc) / ?)::bigint AS gx,
+			floor(ST_Y(merc) / ?)::bigint AS gy,
+			category, status,
+			count(*) AS n,
+			SUM(latitude) AS sum_lat, SUM(longitude) AS sum_lng,
+			MIN(latitude) AS min_lat, MIN(longitude) AS min_lng,
+			MAX(latitude) AS max_lat, MAX(longitude) AS max_lng
+		FROM m
+		GROUP BY 1, 2, category, status`
+	if err := db.Raw(query, append(args, cell, cell)...).Scan(&rows).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error agrupando puntos"})
+		return
+	}
+
+	byCell := map[[2]int64]*MapCluster{}
+	clusters := []*MapCluster{}
+	for _, r := range rows {
+		key := [2]int64{r.GX, r.GY}
+		cl := byCell[key]
+		if cl == nil {
+			cl = &MapCluster{
+				ID:            fmt.Sprintf("%d/%d/%d", zoom, r.GX, r.GY),
+				Bounds:        [4]float64{r.MinLng, r.MinLat, r.MaxLng, r.MaxLat},
+				ByCategory:    map[string]int{},
+				ByStatus:      map[string]int{},
+				ExpansionZoom: min(zoom+2, clusterMaxZoom),
+			}
+			byCell[key] = cl
+			clusters = append(clusters, cl)
+		}
+		cl.Count += r.N
+		cl.Latitude += r.SumLat
+		cl.Longitude += r.SumLng
+		cl.ByCategory[r.Category] += r.N
+		cl.ByStatus[r.Status] += r.N
+		cl.Bounds = [4]float64{
+			math.Min(cl.Bounds[0], r.MinLng), math.Min(cl.Bounds[1], r.MinLat),
+			math.Max(cl.Bounds[2], r.MaxLng), math.Max(cl.Bounds[3], r.MaxLat),
+		}
+	}
+	for _, cl := range clusters {
+		cl.Latitude /= float64(cl.Count)
+		cl.Longitude /= float64(cl.Count)
+	}
+
+	c.JSON(200, gin.H{"mode": "cluster", "zoom": zoom, "cell_size_m": cell, "clusters": clusters})
+}
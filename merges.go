@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- FUSIÓN Y SEPARACIÓN DE CAPTURAS DUPLICADAS ---
+
+const LocationMerged = "merged" // Status de una captura absorbida por otra
+
+// Qué pasa con los puntos de los cazadores de las capturas absorbidas
+const (
+	MergeKeepPoints = "keep"     // Conservan los puntos (el duplicado fue de buena fe)
+	MergeClawback   = "clawback" // Se revierten como en un rechazo
+)
+
+// LocationMerge (Historial de fusiones; se conserva también tras separarlas)
+type LocationMerge struct {
+	ID           string              `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	SurvivorID   string              `gorm:"type:uuid;index" json:"survivor_id"`
+	PointsPolicy string              `json:"points_policy"`
+	Note         string              `json:"note"`
+	MergedBy     string              `json:"merged_by"`
+	CreatedAt    time.Time           `json:"created_at"`
+	SplitBy      string              `json:"split_by"`
+	SplitAt      *time.Time          `json:"split_at"`
+	Items        []LocationMergeItem `gorm:"foreignKey:MergeID" json:"items"`
+}
+
+// LocationMergeItem lo necesario para deshacer la fusión de una captura absorbida
+type LocationMergeItem struct {
+	ID             string             `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	MergeID        string             `gorm:"type:uuid;index" json:"merge_id"`
+	LocationID     string             `gorm:"type:uuid;index" json:"location_id"`
+	PreviousStatus string             `json:"previous_status"`
+	VehicleIDs     []string           `gorm:"serializer:json" json:"vehicle_ids"`     // Vehículos re-vinculados al superviviente
+	OfferIDs       []string           `gorm:"serializer:json" json:"offer_ids"`       // Ofertas movidas al superviviente
+	StationAdmins  []string           `gorm:"serializer:json" json:"station_admins"`  // station_admin que tenía la absorbida
+	GrantedAdmins  []string           `gorm:"serializer:json" json:"granted_admins"`  // Roles creados en el superviviente por la fusión
+	PointsReversed map[string]float64 `gorm:"serializer:json" json:"points_reversed"` // vehicle_type -> puntos revertidos
+}
+
+var errMergeSplit = errors.New("la fusión ya fue separada")
+
+// mergeLocations absorbe 'ids' en 'survivorID' dentro de la transacción dada
+func mergeLocations(tx *gorm.DB, survivorID string, ids []string, policy, note, adminID string) (*LocationMerge, error) {
+	// Bloqueo en orden fijo: dos fusiones simultáneas no se bloquean mutuamente
+	all := append([]string{survivorID}, ids...)
+	sort.Strings(all)
+	locked := map[string]*Location{}
+	for _, id := range all {
+		loc, err := lockLocation(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if loc.Status == LocationMerged || loc.Status == "rejected" {
+			return nil, errLocationState
+		}
+		locked[id] = loc
+	}
+
+	merge := LocationMerge{
+		SurvivorID:   survivorID,
+		PointsPolicy: policy,
+		Note:         note,
+		MergedBy:     adminID,
+		CreatedAt:    time.Now(),
+	}
+	for _, id := range ids {
+		item, err := absorbLocation(tx, locked[id], survivorID, policy, adminID)
+		if err != nil {
+			return nil, err
+		}
+		merge.Items = append(merge.Items, *item)
+	}
+	if err := tx.Create(&merge).Error; err != nil {
+		return nil, err
+	}
+	return &merge, nil
+}
+
+// absorbLocation re-apunta todo lo que colgaba de 'loc' hacia el superviviente
+func absorbLocation(tx *gorm.DB, loc *Location, survivorID, policy, adminID string) (*LocationMergeItem, error) {
+	item := LocationMergeItem{LocationID: loc.ID, PreviousStatus: loc.Status}
+
+	// Vehículos vinculados a la estación absorbida
+	if err := tx.Model(&Vehicle{}).Where("station_id = ?", loc.ID).Pluck("id", &item.VehicleIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(item.VehicleIDs) > 0 {
+		if err := tx.Model(&Vehicle{}).Where("id IN ?", item.VehicleIDs).Update("station_id", survivorID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Ofertas publicadas en el comercio absorbido
+	if err := tx.Model(&Offer{}).Where("location_id = ?", loc.ID).Pluck("id", &item.OfferIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(item.OfferIDs) > 0 {
+		if err := tx.Model(&Offer{}).Where("id IN ?", item.OfferIDs).Update("location_id", survivorID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Administradores de la estación absorbida pasan a administrar la superviviente
+	if err := tx.Model(&UserRole{}).Where("role = ? AND station_id = ?", RoleStationAdmin, loc.ID).
+		Pluck("user_id", &item.StationAdmins).Error; err != nil {
+		return nil, err
+	}
+	for _, uid := range item.StationAdmins {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserRole{
+			UserID: uid, Role: RoleStationAdmin, StationID: survivorID, GrantedBy: adminID, CreatedAt: time.Now(),
+		})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected > 0 {
+			item.GrantedAdmins = append(item.GrantedAdmins, uid)
+		}
+		if _, err := revokeRole(tx, uid, RoleStationAdmin, loc.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if policy == MergeClawback {
+		reversed, err := clawbackCapture(tx, loc, "Captura fusionada")
+		if err != nil {
+			return nil, err
+		}
+		item.PointsReversed = reversed
+	}
+
+	// La captura absorbida se conserva (con su foto) pero sale del mapa
+	if err := tx.Model(loc).Updates(map[string]interface{}{
+		"status":      LocationMerged,
+		"merged_into": survivorID,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// splitMerge deshace una fusión: cada captura vuelve a su estado y recupera lo que se movió
+func splitMerge(tx *gorm.DB, mergeID, adminID string) (*LocationMerge, error) {
+	if !isUUID(mergeID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var merge LocationMerge
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&merge, "id = ?", mergeID).Error; err != nil {
+		return nil, err
+	}
+	if merge.SplitAt != nil {
+		return nil, errMergeSplit
+	}
+
+	for _, item := range merge.Items {
+		loc, err := lockLocation(tx, item.LocationID)
+		if err != nil {
+			return nil, err
+		}
+		if loc.Status != LocationMerged {
+			return nil, errLocationState
+		}
+
+		// Solo se devuelve lo que sigue apuntando al superviviente (pudo cambiar después)
+		if len(item.VehicleIDs) > 0 {
+			if err := tx.Model(&Vehicle{}).Where("id IN ? AND station_id = ?", item.VehicleIDs, merge.SurvivorID).
+				Update("station_id", item.LocationID).Error; err != nil {
+				return nil, err
+			}
+		}
+		if len(item.OfferIDs) > 0 {
+			if err := tx.Model(&Offer{}).Where("id IN ? AND location_id = ?", item.OfferIDs, merge.SurvivorID).
+				Update("location_id", item.LocationID).Error; err != nil {
+				return nil, err
+			}
+		}
+		for _, uid := range item.StationAdmins {
+			if err := grantRole(tx, uid, RoleStationAdmin, item.LocationID, adminID); err != nil {
+				return nil, err
+			}
+		}
+		for _, uid := range item.GrantedAdmins {
+			if _, err := revokeRole(tx, uid, RoleStationAdmin, merge.SurvivorID); err != nil {
+				return nil, err
+			}
+		}
+
+		for vehicleType, amount := range item.PointsReversed {
+			if _, err := postPoints(tx, Posting{
+				UserID:      loc.UserID,
+				VehicleType: vehicleType,
+				Type:        TxRestore,
+				Description: "Fusión deshecha: " + loc.ShopName,
+				LocationID:  loc.ID,
+				Debit:       AcctRewards,
+				Credit:      userAccount(loc.UserID, vehicleType),
+				Amount:      amount,
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := tx.Model(loc).Updates(map[string]interface{}{
+			"status":      item.PreviousStatus,
+			"merged_into": nil,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	merge.SplitAt = &now
+	merge.SplitBy = adminID
+	return &merge, tx.Model(&merge).Updates(map[string]interface{}{"split_at": now, "split_by": adminID}).Error
+}
+
+func mergeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "Captura o fusión no encontrada"})
+	case errors.Is(err, errLocationState):
+		c.JSON(409, gin.H{"error": "Alguna captura ya fue fusionada o rechazada"})
+	case errors.Is(err, errMergeSplit):
+		c.JSON(409, gin.H{"error": "La fusión ya fue separada"})
+	default:
+		c.JSON(500, gin.H{"error": "Error procesando fusión"})
+	}
+}
+
+// --- CONTROLADORES ---
+
+func mergeLocationsHandler(c *gin.Context) {
+	var req struct {
+		SurvivorID   string   `json:"survivor_id"`
+		LocationIDs  []string `json:"location_ids"`  // Capturas a absorber
+		PointsPolicy string   `json:"points_policy"` // 'keep' o 'clawback'
+		Note         string   `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.SurvivorID == "" || len(req.LocationIDs) == 0 {
+		c.JSON(400, gin.H{"error": "Faltan datos (survivor_id, location_ids)"})
+		return
+	}
+	if req.PointsPolicy == "" {
+		req.PointsPolicy = MergeKeepPoints
+	}
+	if req.PointsPolicy != MergeKeepPoints && req.PointsPolicy != MergeClawback {
+		c.JSON(400, gin.H{"error": "points_policy debe ser 'keep' o 'clawback'"})
+		return
+	}
+	seen := map[string]bool{req.SurvivorID: true}
+	for _, id := range req.LocationIDs {
+		if seen[id] {
+			c.JSON(400, gin.H{"error": "location_ids repetido o igual al superviviente: " + id})
+			return
+		}
+		seen[id] = true
+	}
+	if len(req.LocationIDs) > 50 {
+		c.JSON(400, gin.H{"error": "Máximo 50 capturas por fusión"})
+		return
+	}
+
+	var merge *LocationMerge
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		merge, err = mergeLocations(tx, req.SurvivorID, req.LocationIDs, req.PointsPolicy, req.Note, currentUserID(c))
+		return err
+	})
+	if err != nil {
+		mergeError(c, err)
+		return
+	}
+	log.Printf("🧬 %d capturas fusionadas en %s por %s (%s)", len(req.LocationIDs), req.SurvivorID, currentUserID(c), req.PointsPolicy)
+	c.JSON(200, merge)
+}
+
+func splitMergeHandler(c *gin.Context) {
+	var merge *LocationMerge
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		merge, err = splitMerge(tx, c.Param("id"), currentUserID(c))
+		return err
+	})
+	if err != nil {
+		mergeError(c, err)
+		return
+	}
+	log.Printf("🧬 Fusión %s separada por %s", merge.ID, currentUserID(c))
+	c.JSON(200, merge)
+}
+
+// listMerges: historial, opcionalmente filtrado por location_id (superviviente o absorbida)
+func listMerges(c *gin.Context) {
+	query := db.Preload("Items").Order("created_at DESC").Limit(200)
+	if id := c.Query("location_id"); id != "" {
+		query = query.Where("survivor_id = ? OR id IN (?)", id,
+			db.Model(&LocationMergeItem{}).Select("merge_id").Where("location_id = ?", id))
+	}
+	var merges []LocationMerge
+	if err := query.Find(&merges).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando fusiones"})
+		return
+	}
+	c.JSON(200, merges)
+}
+
+// listLocationPhotos: fotos de la captura y de todas las que absorbió
+func listLocationPhotos(c *gin.Context) {
+	var photos []struct {
+		LocationID string    `json:"location_id"`
+		UserID     string    `json:"user_id"`
+		PhotoURL   string    `json:"photo_url"`
+		MediumURL  string    `json:"medium_url"`
+		ThumbURL   string    `json:"thumb_url"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+	// Recursivo: una superviviente pudo ser absorbida después por otra
+	if err := db.Raw(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM locations WHERE id = ?
+			UNION
+			SELECT l.id FROM locations l JOIN tree t ON l.merged_into = t.id
+		)
+		SELECT l.id AS location_id, l.user_id, l.photo_url, l.medium_url, l.thumb_url, l.created_at
+		FROM locations l JOIN tree t ON t.id = l.id
+		WHERE COALESCE(l.photo_url, '') <> ''
+		ORDER BY l.created_at ASC`, c.Param("id")).Scan(&photos).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando fotos"})
+		return
+	}
+	c.JSON(200, photos)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// --- MIGRACIONES VERSIONADAS ---
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Versión de la línea base: por debajo están las tablas previas a las migraciones (nunca se revierte)
+const baselineVersion = 1
+
+// Clave del advisory lock de Postgres (evita que dos instancias migren a la vez)
+const migrationLockKey = 7240911
+
+var migrationName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// loadMigrations lee los pares NNNN_nombre.{up,down}.sql embebidos, ordenados por versión
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*migration{}
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("nombre de migración inválido: %s", e.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := migrationFiles.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("versión %d duplicada (%s / %s)", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	var list []migration
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migración %d_%s sin up o down", mig.Version, mig.Name)
+		}
+		list = append(list, *mig)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// withMigrationLock ejecuta fn en una conexión dedicada que sostiene el advisory lock
+func withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("tomando advisory lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    bigint PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT NOW()
+	)`); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var v int64
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration corre el SQL y registra/borra la versión en la misma transacción
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	body := m.Down
+	if up {
+		body = m.Up
+	}
+	// Sin argumentos pgx usa el protocolo simple: admite varias sentencias por archivo
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return fmt.Errorf("migración %d_%s: %w", m.Version, m.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateUp aplica hasta 'steps' migraciones pendientes (0 = todas)
+func migrateUp(ctx context.Context, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		done := 0
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if steps > 0 && done >= steps {
+				break
+			}
+			log.Printf("⬆️ Aplicando migración %04d_%s", m.Version, m.Name)
+			if err := applyMigration(ctx, conn, m, true); err != nil {
+				return err
+			}
+			done++
+		}
+		if done == 0 {
+			log.Println("✅ Esquema al día")
+		}
+		return nil
+	})
+}
+
+// migrateDown revierte las últimas 'steps' migraciones aplicadas
+func migrateDown(ctx context.Context, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		done := 0
+		for i := len(migrations) - 1; i >= 0 && done < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Version <= baselineVersion {
+				return fmt.Errorf("no se puede revertir la línea base %04d_%s", m.Version, m.Name)
+			}
+			log.Printf("⬇️ Revirtiendo migración %04d_%s", m.Version, m.Name)
+			if err := applyMigration(ctx, conn, m, false); err != nil {
+				return err
+			}
+			done++
+		}
+		return nil
+	})
+}
+
+// migrateStatus imprime cada migración con su fecha de aplicación
+func migrateStatus(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := "pendiente"
+			if at, ok := applied[m.Version]; ok {
+				state = "aplicada " + at.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-40s %s\n", m.Version, m.Name, state)
+		}
+		return nil
+	})
+}
+
+// runMigrateCommand implementa `migrate up [n] | down [n] | status`
+func runMigrateCommand(args []string) error {
+	ctx := context.Background()
+	if len(args) == 0 {
+		return fmt.Errorf("uso: migrate up [n] | down [n] | status")
+	}
+
+	steps := 0
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("número de pasos inválido: %s", args[1])
+		}
+		steps = n
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, steps)
+	case "down":
+		if steps == 0 {
+			steps = 1 // Por seguridad, down revierte una sola migración por defecto
+		}
+		return migrateDown(ctx, steps)
+	case "status":
+		return migrateStatus(ctx)
+	}
+	return fmt.Errorf("subcomando desconocido: %s", args[0])
+}
@@ -0,0 +1,6 @@
+-- La línea base es irreversible: vehicles, wallets, locations y transactions existían
+-- en producción antes de las migraciones, y user_roles/hunters ya traen datos reales.
+DO $$
+BEGIN
+    RAISE EXCEPTION 'la migración 0001_baseline no se puede revertir';
+END $$;
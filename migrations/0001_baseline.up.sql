@@ -0,0 +1,108 @@
+-- Esquema base (equivalente a lo que creaba AutoMigrate).
+-- Idempotente: las bases existentes ya tienen estas tablas.
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+CREATE TABLE IF NOT EXISTS vehicles (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id     text,
+    user_email  text,
+    user_photo  text,
+    type        text,
+    brand       text,
+    model       text,
+    year        bigint,
+    is_active   boolean DEFAULT true,
+    status      text DEFAULT 'SHADOW',
+    role        text DEFAULT 'driver',
+    station_id  text,
+    created_at  timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_vehicles_user_id ON vehicles (user_id);
+
+CREATE TABLE IF NOT EXISTS wallets (
+    user_id          text PRIMARY KEY,
+    balance_moto     numeric,
+    balance_car      numeric,
+    lifetime_points  numeric,
+    goal             numeric DEFAULT 500,
+    status           text DEFAULT 'active',
+    level_name       text DEFAULT 'Novato'
+);
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_user_id_fkey;
+
+CREATE TABLE IF NOT EXISTS locations (
+    id                 uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id            text,
+    vehicle_type       text,
+    shop_name          text,
+    category           text,
+    photo_url          text,
+    latitude           numeric,
+    longitude          numeric,
+    status             text DEFAULT 'pending',
+    is_shadow          boolean,
+    activation_status  text,
+    asset_type         text,
+    daily_pin          text,
+    pin_updated_at     timestamptz,
+    geom               geography(POINT, 4326)
+);
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS pin_epoch bigint;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS timezone text DEFAULT 'America/Caracas';
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS created_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_locations_user_id ON locations (user_id);
+CREATE INDEX IF NOT EXISTS idx_locations_created_at ON locations (created_at);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id            uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id       text,
+    vehicle_type  text,
+    type          text,
+    amount        numeric,
+    description   text,
+    created_at    timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions (user_id);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id     text,
+    role        text,
+    station_id  text DEFAULT '',
+    granted_by  text,
+    created_at  timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_role_scope ON user_roles (user_id, role, station_id);
+
+CREATE TABLE IF NOT EXISTS hunters (
+    user_id             text PRIMARY KEY,
+    status              text DEFAULT 'invited',
+    daily_quota         bigint DEFAULT 50,
+    allowed_categories  text,
+    invited_by          text,
+    suspended_reason    text,
+    created_at          timestamptz,
+    updated_at          timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_hunters_status ON hunters (status);
+
+CREATE TABLE IF NOT EXISTS pin_lockouts (
+    scope         text,
+    subject       text,
+    failures      bigint,
+    locked_until  timestamptz,
+    updated_at    timestamptz,
+    PRIMARY KEY (scope, subject)
+);
+
+CREATE TABLE IF NOT EXISTS pin_attempts (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id     text,
+    station_id  text,
+    success     boolean,
+    reason      text,
+    ip          text,
+    created_at  timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_pin_attempts_user_id ON pin_attempts (user_id);
+CREATE INDEX IF NOT EXISTS idx_pin_attempts_station_id ON pin_attempts (station_id);
@@ -0,0 +1,2 @@
+-- Corrección de datos irreversible: no hay estado previo que restaurar.
+SELECT 1;
@@ -0,0 +1,24 @@
+-- Correcciones de datos que antes corrían en cada arranque. Ahora corren una sola vez.
+
+-- Filas anteriores a la columna status: quedan aprobadas.
+-- Las 'pending' NO se tocan: esperan moderación.
+UPDATE locations SET status = 'approved' WHERE status IS NULL;
+
+-- La tabla offers puede no existir en bases nuevas
+DO $$
+BEGIN
+    IF to_regclass('public.offers') IS NOT NULL THEN
+        UPDATE offers SET status = 'active' WHERE status IS NULL;
+    END IF;
+END $$;
+
+-- Roles: los station_admin legados (vehicles.role) pasan a user_roles
+INSERT INTO user_roles (user_id, role, station_id, granted_by, created_at)
+SELECT DISTINCT user_id, 'station_admin', station_id, 'legacy', NOW() FROM vehicles
+WHERE role = 'station_admin' AND station_id <> ''
+ON CONFLICT DO NOTHING;
+
+-- Cazadores: quien ya capturó antes queda activo en la allowlist
+INSERT INTO hunters (user_id, status, daily_quota, allowed_categories, invited_by, created_at, updated_at)
+SELECT DISTINCT user_id, 'active', 50, '[]', 'legacy', NOW(), NOW() FROM locations WHERE user_id <> ''
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+-- La tabla offers es anterior a las migraciones: solo se quitan las columnas añadidas.
+DROP INDEX IF EXISTS idx_offers_location_gist;
+DROP INDEX IF EXISTS idx_offers_location_id;
+ALTER TABLE offers DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE offers DROP COLUMN IF EXISTS created_at;
+ALTER TABLE offers DROP COLUMN IF EXISTS created_by;
+ALTER TABLE offers DROP COLUMN IF EXISTS location_id;
@@ -0,0 +1,17 @@
+-- Ofertas publicadas por comercios. En producción la tabla ya existe (sin modelo Go):
+-- solo se crea si falta y se añaden las columnas de propiedad y auditoría.
+CREATE TABLE IF NOT EXISTS offers (
+    id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    title        text NOT NULL,
+    description  text,
+    price        numeric NOT NULL,
+    category     text NOT NULL,
+    status       text DEFAULT 'active',
+    location     geography(POINT, 4326)
+);
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS location_id uuid;
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS created_by text;
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS created_at timestamptz DEFAULT NOW();
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS updated_at timestamptz DEFAULT NOW();
+CREATE INDEX IF NOT EXISTS idx_offers_location_id ON offers (location_id);
+CREATE INDEX IF NOT EXISTS idx_offers_location_gist ON offers USING GIST (location);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_offers_flash_window;
+ALTER TABLE offers DROP COLUMN IF EXISTS stock_remaining;
+ALTER TABLE offers DROP COLUMN IF EXISTS stock_limit;
+ALTER TABLE offers DROP COLUMN IF EXISTS ends_at;
+ALTER TABLE offers DROP COLUMN IF EXISTS starts_at;
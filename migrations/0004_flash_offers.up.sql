@@ -0,0 +1,8 @@
+-- Ofertas flash: ventana de tiempo y stock opcional.
+-- status pasa a text: el enum legado no conoce 'scheduled', 'expired' ni 'paused'.
+ALTER TABLE offers ALTER COLUMN status TYPE text USING status::text;
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS starts_at timestamptz;
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS ends_at timestamptz;
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS stock_limit bigint;
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS stock_remaining bigint;
+CREATE INDEX IF NOT EXISTS idx_offers_flash_window ON offers (status, starts_at, ends_at) WHERE ends_at IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS redemptions;
+ALTER TABLE wallets DROP COLUMN IF EXISTS held_car;
+ALTER TABLE wallets DROP COLUMN IF EXISTS held_moto;
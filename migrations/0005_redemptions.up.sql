@@ -0,0 +1,22 @@
+-- Canjes: solicitud -> aprobado -> pagado / rechazado, con saldo retenido
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS held_moto numeric DEFAULT 0;
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS held_car numeric DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS redemptions (
+    id                 uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id            text NOT NULL,
+    vehicle_type       text NOT NULL,
+    amount             numeric NOT NULL,
+    status             text NOT NULL DEFAULT 'requested',
+    payment_reference  text,
+    reject_reason      text,
+    reviewed_by        text,
+    created_at         timestamptz NOT NULL DEFAULT NOW(),
+    updated_at         timestamptz NOT NULL DEFAULT NOW(),
+    approved_at        timestamptz,
+    paid_at            timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_redemptions_user_id ON redemptions (user_id);
+CREATE INDEX IF NOT EXISTS idx_redemptions_status ON redemptions (status);
+-- Un solo canje abierto por usuario
+CREATE UNIQUE INDEX IF NOT EXISTS idx_redemptions_one_open ON redemptions (user_id) WHERE status IN ('requested', 'approved');
@@ -0,0 +1,46 @@
+-- Libro mayor de partida doble (append-only)
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id              uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    transaction_id  uuid,
+    debit_account   text NOT NULL,
+    credit_account  text NOT NULL,
+    amount          numeric NOT NULL CHECK (amount > 0),
+    created_at      timestamptz NOT NULL DEFAULT NOW(),
+    CHECK (debit_account <> credit_account)
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_transaction_id ON ledger_entries (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_debit_account ON ledger_entries (debit_account);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_credit_account ON ledger_entries (credit_account);
+
+CREATE OR REPLACE FUNCTION ledger_entries_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger_entries es append-only: usa un asiento compensatorio';
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_ledger_entries_append_only ON ledger_entries;
+CREATE TRIGGER trg_ledger_entries_append_only
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_entries_append_only();
+
+-- Saldos de apertura: los wallets existentes pasan a ser asientos del libro.
+-- Todo lo emitido de por vida sale de system:rewards; lo ya canjeado se da por pagado.
+WITH w AS (
+    SELECT user_id,
+           COALESCE(balance_moto, 0) AS bm, COALESCE(balance_car, 0) AS bc,
+           COALESCE(held_moto, 0) AS hm, COALESCE(held_car, 0) AS hc,
+           GREATEST(COALESCE(lifetime_points, 0) - COALESCE(balance_car, 0) - COALESCE(held_car, 0),
+                    COALESCE(balance_moto, 0) + COALESCE(held_moto, 0)) AS issued_moto
+    FROM wallets
+), opening (debit_account, credit_account, amount) AS (
+    SELECT 'system:rewards', 'user:' || user_id || ':car', bc + hc FROM w
+    UNION ALL
+    SELECT 'system:rewards', 'user:' || user_id || ':moto', issued_moto FROM w
+    UNION ALL
+    SELECT 'user:' || user_id || ':car', 'user:' || user_id || ':held_car', hc FROM w
+    UNION ALL
+    SELECT 'user:' || user_id || ':moto', 'user:' || user_id || ':held_moto', hm FROM w
+    UNION ALL
+    SELECT 'user:' || user_id || ':moto', 'system:payouts', issued_moto - bm - hm FROM w
+)
+INSERT INTO ledger_entries (debit_account, credit_account, amount)
+SELECT debit_account, credit_account, amount FROM opening WHERE amount > 0;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_transactions_location_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS location_id;
+DROP INDEX IF EXISTS idx_locations_status;
+ALTER TABLE locations DROP COLUMN IF EXISTS reviewed_at;
+ALTER TABLE locations DROP COLUMN IF EXISTS review_note;
+ALTER TABLE locations DROP COLUMN IF EXISTS review_reason;
+ALTER TABLE locations DROP COLUMN IF EXISTS reviewed_by;
@@ -0,0 +1,10 @@
+-- Cola de moderación de capturas
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS reviewed_by text;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS review_reason text;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS review_note text;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS reviewed_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_locations_status ON locations (status);
+
+-- Vincula los movimientos con la captura que los originó (para revertirlos)
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS location_id uuid;
+CREATE INDEX IF NOT EXISTS idx_transactions_location_id ON transactions (location_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_locations_gps_mismatch;
+ALTER TABLE locations DROP COLUMN IF EXISTS gps_mismatch;
+ALTER TABLE locations DROP COLUMN IF EXISTS photo_gps_distance;
+ALTER TABLE locations DROP COLUMN IF EXISTS medium_url;
+ALTER TABLE locations DROP COLUMN IF EXISTS thumb_url;
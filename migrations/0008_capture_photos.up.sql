@@ -0,0 +1,6 @@
+-- Renditions de la foto y verificación del GPS del EXIF
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS thumb_url text;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS medium_url text;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS photo_gps_distance double precision;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS gps_mismatch boolean NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS idx_locations_gps_mismatch ON locations (gps_mismatch) WHERE gps_mismatch;
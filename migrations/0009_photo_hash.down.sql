@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_locations_duplicate_photo_of;
+ALTER TABLE locations DROP COLUMN IF EXISTS photo_hash_distance;
+ALTER TABLE locations DROP COLUMN IF EXISTS duplicate_photo_of;
+ALTER TABLE locations DROP COLUMN IF EXISTS photo_hash;
@@ -0,0 +1,5 @@
+-- Hash perceptual (dHash) de la foto para detectar capturas repetidas
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS photo_hash bigint;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS duplicate_photo_of uuid;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS photo_hash_distance integer;
+CREATE INDEX IF NOT EXISTS idx_locations_duplicate_photo_of ON locations (duplicate_photo_of);
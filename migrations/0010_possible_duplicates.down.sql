@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_locations_possible_duplicate_of;
+ALTER TABLE locations DROP COLUMN IF EXISTS duplicate_score;
+ALTER TABLE locations DROP COLUMN IF EXISTS possible_duplicate_of;
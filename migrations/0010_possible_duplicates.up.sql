@@ -0,0 +1,4 @@
+-- Capturas guardadas pese a parecer duplicadas (el cazador confirmó)
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS possible_duplicate_of uuid;
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS duplicate_score double precision;
+CREATE INDEX IF NOT EXISTS idx_locations_possible_duplicate_of ON locations (possible_duplicate_of);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS location_merge_items;
+DROP TABLE IF EXISTS location_merges;
+DROP INDEX IF EXISTS idx_locations_merged_into;
+ALTER TABLE locations DROP COLUMN IF EXISTS merged_into;
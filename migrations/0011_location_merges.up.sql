@@ -0,0 +1,29 @@
+-- Fusión de capturas duplicadas (las absorbidas quedan con status 'merged')
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS merged_into uuid;
+CREATE INDEX IF NOT EXISTS idx_locations_merged_into ON locations (merged_into);
+
+CREATE TABLE IF NOT EXISTS location_merges (
+    id             uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    survivor_id    uuid NOT NULL,
+    points_policy  text NOT NULL,
+    note           text,
+    merged_by      text NOT NULL,
+    created_at     timestamptz NOT NULL DEFAULT NOW(),
+    split_by       text,
+    split_at       timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_location_merges_survivor_id ON location_merges (survivor_id);
+
+CREATE TABLE IF NOT EXISTS location_merge_items (
+    id               uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    merge_id         uuid NOT NULL REFERENCES location_merges (id),
+    location_id      uuid NOT NULL,
+    previous_status  text,
+    vehicle_ids      text,
+    offer_ids        text,
+    station_admins   text,
+    granted_admins   text,
+    points_reversed  text
+);
+CREATE INDEX IF NOT EXISTS idx_location_merge_items_merge_id ON location_merge_items (merge_id);
+CREATE INDEX IF NOT EXISTS idx_location_merge_items_location_id ON location_merge_items (location_id);
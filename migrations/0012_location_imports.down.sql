@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_locations_import_id;
+ALTER TABLE locations DROP COLUMN IF EXISTS import_id;
+DROP TABLE IF EXISTS location_imports;
@@ -0,0 +1,16 @@
+-- Importaciones masivas de capturas (revertibles por import_id)
+CREATE TABLE IF NOT EXISTS location_imports (
+    id              uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    format          text NOT NULL,
+    file_name       text,
+    status          text NOT NULL,
+    total_rows      integer NOT NULL DEFAULT 0,
+    imported        integer NOT NULL DEFAULT 0,
+    skipped         integer NOT NULL DEFAULT 0,
+    created_by      text NOT NULL,
+    created_at      timestamptz NOT NULL DEFAULT NOW(),
+    rolled_back_at  timestamptz
+);
+
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS import_id uuid;
+CREATE INDEX IF NOT EXISTS idx_locations_import_id ON locations (import_id);
@@ -0,0 +1,30 @@
+-- Reglas configurables de puntos por captura (reemplazan los 10 puntos fijos)
+CREATE TABLE IF NOT EXISTS points_rules (
+    id             uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name           text NOT NULL,
+    kind           text NOT NULL,
+    value          double precision NOT NULL,
+    priority       integer NOT NULL DEFAULT 0,
+    category       text NOT NULL DEFAULT '',
+    vehicle_type   text NOT NULL DEFAULT '',
+    zone_lat       double precision,
+    zone_lng       double precision,
+    zone_radius_m  double precision,
+    starts_at      timestamptz,
+    ends_at        timestamptz,
+    hour_from      integer,
+    hour_to        integer,
+    condition      text NOT NULL DEFAULT '',
+    radius_m       double precision NOT NULL DEFAULT 0,
+    threshold      double precision NOT NULL DEFAULT 0,
+    active         boolean NOT NULL DEFAULT true,
+    created_by     text,
+    created_at     timestamptz NOT NULL DEFAULT NOW(),
+    updated_at     timestamptz NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_points_rules_active ON points_rules (active);
+
+-- Regla base equivalente al comportamiento anterior
+INSERT INTO points_rules (name, kind, value, created_by)
+SELECT 'Captura estándar', 'base', 10, 'migration'
+WHERE NOT EXISTS (SELECT 1 FROM points_rules);
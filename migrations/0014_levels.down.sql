@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS level_ups;
+DROP TABLE IF EXISTS levels;
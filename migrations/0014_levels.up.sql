@@ -0,0 +1,35 @@
+-- Niveles por puntos de por vida (Wallet.level_name / Wallet.goal dejan de ser fijos)
+CREATE TABLE IF NOT EXISTS levels (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        text NOT NULL UNIQUE,
+    threshold   double precision NOT NULL UNIQUE,
+    goal        double precision NOT NULL,
+    perks       text,
+    created_at  timestamptz NOT NULL DEFAULT NOW(),
+    updated_at  timestamptz NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO levels (name, threshold, goal, perks) VALUES
+    ('Novato', 0, 500, '[]'),
+    ('Explorador', 1000, 750, '["Insignia de Explorador"]'),
+    ('Cazador', 5000, 1000, '["Insignia de Cazador", "Prioridad en moderación"]'),
+    ('Leyenda', 15000, 1500, '["Insignia de Leyenda", "Prioridad en moderación", "Acceso anticipado a ofertas flash"]')
+ON CONFLICT DO NOTHING;
+
+-- Eventos de subida de nivel
+CREATE TABLE IF NOT EXISTS level_ups (
+    id               uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id          text NOT NULL,
+    from_level       text,
+    to_level         text NOT NULL,
+    lifetime_points  double precision NOT NULL,
+    created_at       timestamptz NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_level_ups_user_id ON level_ups (user_id);
+
+-- Billeteras existentes: nivel que ya les corresponde por sus puntos
+UPDATE wallets w
+SET level_name = l.name, goal = l.goal
+FROM levels l
+WHERE l.threshold = (SELECT MAX(threshold) FROM levels WHERE threshold <= COALESCE(w.lifetime_points, 0))
+    AND w.level_name IS DISTINCT FROM l.name;
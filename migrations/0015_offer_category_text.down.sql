@@ -0,0 +1,2 @@
+-- El enum legado no se recrea: la columna queda en text.
+SELECT 1;
@@ -0,0 +1,3 @@
+-- category pasa a text: el enum legado no conoce todas las categorías de caza
+-- que aceptan las ofertas (se validan contra huntCategories en la API).
+ALTER TABLE offers ALTER COLUMN category TYPE text USING category::text;
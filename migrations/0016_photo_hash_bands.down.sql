@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_locations_photo_hash_bands;
+ALTER TABLE locations DROP COLUMN IF EXISTS photo_hash_bands;
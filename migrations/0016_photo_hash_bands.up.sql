@@ -0,0 +1,12 @@
+-- Bandas de 16 bits del dHash (clave = banda << 16 | valor) para buscar fotos parecidas
+-- por índice en lugar de comparar contra todas las capturas.
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS photo_hash_bands integer[]
+    GENERATED ALWAYS AS (
+        CASE WHEN photo_hash IS NULL THEN NULL ELSE ARRAY[
+            (photo_hash & 65535)::integer,
+            (65536 | ((photo_hash >> 16) & 65535))::integer,
+            (131072 | ((photo_hash >> 32) & 65535))::integer,
+            (196608 | ((photo_hash >> 48) & 65535))::integer
+        ] END
+    ) STORED;
+CREATE INDEX IF NOT EXISTS idx_locations_photo_hash_bands ON locations USING GIN (photo_hash_bands);
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- MODERACIÓN DE CAPTURAS ---
+
+// Códigos de rechazo (el FE los traduce para el cazador)
+var rejectReasons = map[string]bool{
+	"duplicate":      true, // Ya existe en el mapa
+	"bad_photo":      true, // Foto borrosa, oscura o ausente
+	"wrong_category": true,
+	"wrong_location": true, // Coordenadas no corresponden al negocio
+	"not_a_business": true,
+	"closed":         true, // Negocio cerrado definitivamente
+	"fraud":          true,
+	"other":          true,
+}
+
+var errLocationState = errors.New("la captura no está en un estado moderable")
+
+// lockLocation bloquea la captura para moderarla
+func lockLocation(tx *gorm.DB, id string) (*Location, error) {
+	if !isUUID(id) {
+		return nil, gorm.ErrRecordNotFound // Postgres rechazaría el cast a uuid con un 500
+	}
+	var loc Location
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&loc, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &loc, nil
+}
+
+// clawbackCapture revierte los puntos netos que otorgó la captura (ganados + restituidos - ya revertidos).
+// El saldo puede quedar negativo si el cazador ya canjeó esos puntos. Devuelve lo revertido por vehicle_type.
+func clawbackCapture(tx *gorm.DB, loc *Location, desc string) (map[string]float64, error) {
+	var rows []struct {
+		VehicleType string
+		Net         float64
+	}
+	if err := tx.Model(&Transaction{}).
+		Select("vehicle_type, SUM(amount) AS net").
+		Where("location_id = ? AND type IN ?", loc.ID, []string{TxEarning, TxClawback, TxRestore}).
+		Group("vehicle_type").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	reversed := map[string]float64{}
+	for _, r := range rows {
+		if r.Net <= 0 {
+			continue
+		}
+		if _, err := postPoints(tx, Posting{
+			UserID:      loc.UserID,
+			VehicleType: r.VehicleType,
+			Type:        TxClawback,
+			Description: desc + ": " + loc.ShopName,
+			LocationID:  loc.ID,
+			Debit:       userAccount(loc.UserID, r.VehicleType),
+			Credit:      AcctRewards,
+			Amount:      r.Net,
+		}); err != nil {
+			return nil, err
+		}
+		reversed[r.VehicleType] = r.Net
+	}
+	return reversed, nil
+}
+
+func moderationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "Captura no encontrada"})
+	case errors.Is(err, errLocationState):
+		c.JSON(409, gin.H{"error": "La captura ya fue moderada"})
+	default:
+		c.JSON(500, gin.H{"error": "Error moderando captura"})
+	}
+}
+
+// --- CONTROLADORES ---
+
+// listLocationQueue: filtros status (por defecto 'pending'), category, user_id, gps_mismatch, duplicate_photo, possible_duplicate; paginación limit/offset
+func listLocationQueue(c *gin.Context) {
+	status := c.DefaultQuery("status", "pending")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := db.Model(&Location{}).Where("status = ?", status)
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if c.Query("gps_mismatch") == "true" {
+		query = query.Where("gps_mismatch")
+	}
+	if c.Query("duplicate_photo") == "true" {
+		query = query.Where("duplicate_photo_of IS NOT NULL")
+	}
+	if c.Query("possible_duplicate") == "true" {
+		query = query.Where("possible_duplicate_of IS NOT NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando cola"})
+		return
+	}
+	var locations []Location
+	// Las más antiguas primero: la cola se atiende en orden de llegada
+	if err := query.Order("created_at ASC").Limit(limit).Offset(offset).Find(&locations).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando cola"})
+		return
+	}
+	c.JSON(200, gin.H{"total": total, "items": locations})
+}
+
+func approveLocation(c *gin.Context) {
+	var loc *Location
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if loc, err = lockLocation(tx, c.Param("id")); err != nil {
+			return err
+		}
+		if loc.Status != "pending" {
+			return errLocationState
+		}
+		now := time.Now()
+		return tx.Model(loc).Updates(map[string]interface{}{
+			"status":        "approved",
+			"reviewed_by":   currentUserID(c),
+			"review_reason": "",
+			"review_note":   "",
+			"reviewed_at":   now,
+		}).Error
+	})
+	if err != nil {
+		moderationError(c, err)
+		return
+	}
+	log.Printf("🛡️ Captura %s aprobada por %s", loc.ID, currentUserID(c))
+	c.JSON(200, gin.H{"message": "Captura aprobada", "new_status": "approved"})
+}
+
+func rejectLocation(c *gin.Context) {
+	var req struct {
+		ReasonCode string `json:"reason_code"`
+		Note       string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !rejectReasons[req.ReasonCode] {
+		c.JSON(400, gin.H{"error": "reason_code inválido"})
+		return
+	}
+
+	var loc *Location
+	var clawed float64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if loc, err = lockLocation(tx, c.Param("id")); err != nil {
+			return err
+		}
+		// Una captura aprobada también puede rechazarse después (p.ej. fraude detectado tarde)
+		if loc.Status != "pending" && loc.Status != "approved" {
+			return errLocationState
+		}
+		if err := tx.Model(loc).Updates(map[string]interface{}{
+			"status":        "rejected",
+			"reviewed_by":   currentUserID(c),
+			"review_reason": req.ReasonCode,
+			"review_note":   req.Note,
+			"reviewed_at":   time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		reversed, err := clawbackCapture(tx, loc, "Captura rechazada")
+		for _, amount := range reversed {
+			clawed += amount
+		}
+		return err
+	})
+	if err != nil {
+		moderationError(c, err)
+		return
+	}
+	log.Printf("🛡️ Captura %s rechazada por %s (%s), %.0f pts revertidos", loc.ID, currentUserID(c), req.ReasonCode, clawed)
+	c.JSON(200, gin.H{"message": "Captura rechazada", "new_status": "rejected", "points_reversed": clawed})
+}
+
+// listMyCaptures: el cazador ve el estado y motivo de moderación de sus capturas
+func listMyCaptures(c *gin.Context) {
+	var captures []struct {
+		ID           string     `json:"id"`
+		ShopName     string     `json:"shop_name"`
+		Category     string     `json:"category"`
+		PhotoURL     string     `json:"photo_url"`
+		ThumbURL     string     `json:"thumb_url"`
+		Status       string     `json:"status"`
+		ReviewReason string     `json:"review_reason"`
+		ReviewNote   string     `json:"review_note"`
+		ReviewedAt   *time.Time `json:"reviewed_at"`
+		CreatedAt    time.Time  `json:"created_at"`
+	}
+	query := db.Model(&Location{}).Where("user_id = ?", currentUserID(c)).Order("created_at DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Limit(200).Scan(&captures).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando capturas"})
+		return
+	}
+	c.JSON(200, captures)
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- OFERTAS (Comercios) ---
+
+const (
+	OfferActive    = "active"
+	OfferPaused    = "paused"
+	OfferSuspended = "suspended"
+	// Ofertas flash (con ventana starts_at/ends_at)
+	OfferScheduled = "scheduled"
+	OfferFlash     = "flash"
+	OfferExpired   = "expired"
+)
+
+// Ventana máxima de una oferta flash
+const maxFlashWindow = 7 * 24 * time.Hour
+
+// Distancia máxima entre la oferta y su comercio
+const maxOfferDistanceMeters = 200
+
+const maxOfferPrice = 1000000
+
+// Offer (Oferta publicada por un comercio dueño de una Location)
+type Offer struct {
+	ID             string      `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	LocationID     string      `gorm:"type:uuid;index" json:"location_id"`
+	Title          string      `json:"title"`
+	Description    string      `json:"description"`
+	Price          float64     `json:"price"`
+	Category       string      `json:"category"`
+	Status         string      `gorm:"default:'active'" json:"status"` // 'active', 'paused', 'suspended', 'scheduled', 'flash', 'expired'
+	StartsAt       *time.Time  `json:"starts_at"`
+	EndsAt         *time.Time  `json:"ends_at"`
+	StockLimit     *int64      `json:"stock_limit"`
+	StockRemaining *int64      `json:"stock_remaining"`
+	Geo            interface{} `gorm:"column:location;type:geography(POINT,4326)" json:"-"`
+	Latitude       float64     `gorm:"->;-:migration" json:"latitude"` // Solo lectura (ST_Y de location)
+	Longitude      float64     `gorm:"->;-:migration" json:"longitude"`
+	CreatedBy      string      `json:"created_by"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+type offerRequest struct {
+	LocationID  string   `json:"location_id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Price       float64  `json:"price"`
+	Category    string   `json:"category"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	// Solo al crear: convierte la oferta en flash
+	StartsAt   *time.Time `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at"`
+	StockLimit *int64     `json:"stock_limit"`
+}
+
+func (req *offerRequest) validate() string {
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" || len(req.Title) > 120 {
+		return "El título es obligatorio (máx. 120 caracteres)"
+	}
+	if len(req.Description) > 1000 {
+		return "Descripción demasiado larga (máx. 1000 caracteres)"
+	}
+	if math.IsNaN(req.Price) || req.Price <= 0 || req.Price > maxOfferPrice {
+		return "Precio inválido"
+	}
+	if !huntCategories[req.Category] {
+		return "Categoría no permitida: " + req.Category
+	}
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		return "latitude y longitude van juntos"
+	}
+	if req.Latitude != nil && !validCoords(*req.Latitude, *req.Longitude) {
+		return "Coordenadas fuera de rango"
+	}
+	return ""
+}
+
+// validateFlash valida la ventana y el stock de una oferta flash nueva
+func (req *offerRequest) validateFlash(now time.Time) string {
+	if req.EndsAt == nil {
+		if req.StartsAt != nil || req.StockLimit != nil {
+			return "Las ofertas flash requieren ends_at"
+		}
+		return ""
+	}
+	start := now
+	if req.StartsAt != nil {
+		start = *req.StartsAt
+	}
+	if !req.EndsAt.After(now) || !req.EndsAt.After(start) {
+		return "ends_at debe ser posterior a ahora y a starts_at"
+	}
+	if req.EndsAt.Sub(start) > maxFlashWindow {
+		return "La ventana flash no puede superar 7 días"
+	}
+	if req.StockLimit != nil && *req.StockLimit <= 0 {
+		return "stock_limit debe ser mayor que 0"
+	}
+	return ""
+}
+
+// initialStatus decide el estado inicial: normal, programada o flash en curso
+func (req *offerRequest) initialStatus(now time.Time) string {
+	if req.EndsAt == nil {
+		return OfferActive
+	}
+	if req.StartsAt != nil && req.StartsAt.After(now) {
+		return OfferScheduled
+	}
+	return OfferFlash
+}
+
+func validCoords(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 && !(lat == 0 && lng == 0)
+}
+
+// canManageLocation: moderación global o station_admin de esa misma Location
+func canManageLocation(c *gin.Context, locationID string) (bool, error) {
+	roles, err := loadUserRoles(db, currentUserID(c))
+	if err != nil {
+		return false, err
+	}
+	return hasPermission(roles, PermManageOffers) || stationAdminOf(roles, locationID), nil
+}
+
+// loadOwnedOffer busca la oferta y verifica que el usuario puede gestionarla (responde el error)
+func loadOwnedOffer(c *gin.Context) (*Offer, bool) {
+	if !isUUID(c.Param("id")) {
+		c.JSON(404, gin.H{"error": "Oferta no encontrada"})
+		return nil, false
+	}
+	var offer Offer
+	if err := db.First(&offer, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "Oferta no encontrada"})
+		} else {
+			c.JSON(500, gin.H{"error": "Error consultando oferta"})
+		}
+		return nil, false
+	}
+	ok, err := canManageLocation(c, offer.LocationID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando roles"})
+		return nil, false
+	}
+	if !ok {
+		c.JSON(403, gin.H{"error": "Solo puedes gestionar ofertas de tu propio comercio"})
+		return nil, false
+	}
+	return &offer, true
+}
+
+// setOfferGeo fija la posición de la oferta: la indicada (cerca del comercio) o la del comercio
+func setOfferGeo(tx *gorm.DB, offer *Offer, loc *Location, lat, lng *float64) error {
+	if lat == nil {
+		return tx.Exec("UPDATE offers SET location = (SELECT geom FROM locations WHERE id = ?) WHERE id = ?", loc.ID, offer.ID).Error
+	}
+	return tx.Exec("UPDATE offers SET location = ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography WHERE id = ?", *lng, *lat, offer.ID).Error
+}
+
+// offerNearLocation valida que el punto quede a menos de maxOfferDistanceMeters del comercio
+func offerNearLocation(loc *Location, lat, lng float64) (bool, error) {
+	var near bool
+	err := db.Raw("SELECT ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?) FROM locations WHERE id = ?",
+		lng, lat, maxOfferDistanceMeters, loc.ID).Scan(&near).Error
+	return near, err
+}
+
+func fillOfferCoords(offer *Offer) {
+	db.Raw("SELECT ST_Y(location::geometry), ST_X(location::geometry) FROM offers WHERE id = ?", offer.ID).
+		Row().Scan(&offer.Latitude, &offer.Longitude)
+}
+
+// --- CONTROLADORES ---
+
+func listMyOffers(c *gin.Context) {
+	roles, err := loadUserRoles(db, currentUserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando roles"})
+		return
+	}
+	var locationIDs []string
+	for _, r := range roles {
+		if r.Role == RoleStationAdmin {
+			locationIDs = append(locationIDs, r.StationID)
+		}
+	}
+
+	offers := []Offer{}
+	if len(locationIDs) > 0 {
+		if err := db.Raw(`SELECT *, ST_Y(location::geometry) AS latitude, ST_X(location::geometry) AS longitude
+			FROM offers WHERE location_id IN ? ORDER BY created_at DESC`, locationIDs).Scan(&offers).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Error consultando ofertas"})
+			return
+		}
+	}
+	c.JSON(200, offers)
+}
+
+func createOffer(c *gin.Context) {
+	var req offerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	now := time.Now()
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	if msg := req.validateFlash(now); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
+	var loc Location
+	if err := db.First(&loc, "id = ?", req.LocationID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Comercio no encontrado"})
+		return
+	}
+	if ok, err := canManageLocation(c, loc.ID); err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando roles"})
+		return
+	} else if !ok {
+		c.JSON(403, gin.H{"error": "Solo puedes publicar ofertas en tu propio comercio"})
+		return
+	}
+	if loc.Status != "approved" {
+		c.JSON(409, gin.H{"error": "El comercio aún no está aprobado"})
+		return
+	}
+	if req.Latitude != nil {
+		if near, err := offerNearLocation(&loc, *req.Latitude, *req.Longitude); err != nil {
+			c.JSON(500, gin.H{"error": "Error validando ubicación"})
+			return
+		} else if !near {
+			c.JSON(400, gin.H{"error": "La oferta debe estar junto a tu comercio"})
+			return
+		}
+	}
+
+	offer := Offer{
+		LocationID:     loc.ID,
+		Title:          req.Title,
+		Description:    req.Description,
+		Price:          req.Price,
+		Category:       req.Category,
+		Status:         req.initialStatus(now),
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		StockLimit:     req.StockLimit,
+		StockRemaining: req.StockLimit,
+		CreatedBy:      currentUserID(c),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&offer).Error; err != nil {
+			return err
+		}
+		return setOfferGeo(tx, &offer, &loc, req.Latitude, req.Longitude)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error creando oferta"})
+		return
+	}
+	fillOfferCoords(&offer)
+	log.Printf("🏷️ Oferta %s publicada en %s por %s", offer.ID, loc.ID, currentUserID(c))
+	c.JSON(201, offer)
+}
+
+func updateOffer(c *gin.Context) {
+	offer, ok := loadOwnedOffer(c)
+	if !ok {
+		return
+	}
+	var req offerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	if offer.Status == OfferSuspended {
+		c.JSON(409, gin.H{"error": "Oferta suspendida por moderación"})
+		return
+	}
+
+	var loc Location
+	if err := db.First(&loc, "id = ?", offer.LocationID).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando comercio"})
+		return
+	}
+	if req.Latitude != nil {
+		if near, err := offerNearLocation(&loc, *req.Latitude, *req.Longitude); err != nil {
+			c.JSON(500, gin.H{"error": "Error validando ubicación"})
+			return
+		} else if !near {
+			c.JSON(400, gin.H{"error": "La oferta debe estar junto a tu comercio"})
+			return
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(offer).Updates(map[string]interface{}{
+			"title":       req.Title,
+			"description": req.Description,
+			"price":       req.Price,
+			"category":    req.Category,
+			"updated_at":  time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		// Sin coordenadas se conserva la posición actual (no se vuelve al comercio)
+		if req.Latitude == nil {
+			return nil
+		}
+		return setOfferGeo(tx, offer, &loc, req.Latitude, req.Longitude)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error actualizando oferta"})
+		return
+	}
+	db.First(offer, "id = ?", offer.ID)
+	fillOfferCoords(offer)
+	c.JSON(200, offer)
+}
+
+func setOfferStatus(c *gin.Context, from, to string) {
+	offer, ok := loadOwnedOffer(c)
+	if !ok {
+		return
+	}
+	if offer.Status != from {
+		c.JSON(409, gin.H{"error": "La oferta no está en estado " + from})
+		return
+	}
+	if err := db.Model(offer).Updates(map[string]interface{}{"status": to, "updated_at": time.Now()}).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error actualizando oferta"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Oferta actualizada", "new_status": to})
+}
+
+func pauseOffer(c *gin.Context)  { setOfferStatus(c, OfferActive, OfferPaused) }
+func resumeOffer(c *gin.Context) { setOfferStatus(c, OfferPaused, OfferActive) }
+
+func deleteOffer(c *gin.Context) {
+	offer, ok := loadOwnedOffer(c)
+	if !ok {
+		return
+	}
+	if err := db.Delete(offer).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error eliminando oferta"})
+		return
+	}
+	log.Printf("🗑️ Oferta %s eliminada por %s", offer.ID, currentUserID(c))
+	c.JSON(200, gin.H{"message": "Oferta eliminada"})
+}
+
+// --- OFERTAS FLASH ---
+
+// advanceFlashOffers (job) mueve las ofertas flash por scheduled -> flash -> expired
+func advanceFlashOffers(ctx context.Context) error {
+	tx := db.WithContext(ctx)
+	now := time.Now()
+
+	started := tx.Model(&Offer{}).
+		Where("status = ? AND starts_at <= ? AND ends_at > ?", OfferScheduled, now, now).
+		Updates(map[string]interface{}{"status": OfferFlash, "updated_at": now})
+	if started.Error != nil {
+		return started.Error
+	}
+
+	// Vencidas por tiempo o agotadas
+	expired := tx.Model(&Offer{}).
+		Where("status IN ? AND (ends_at <= ? OR stock_remaining <= 0)", []string{OfferScheduled, OfferFlash}, now).
+		Updates(map[string]interface{}{"status": OfferExpired, "updated_at": now})
+	if expired.Error != nil {
+		return expired.Error
+	}
+
+	if started.RowsAffected > 0 || expired.RowsAffected > 0 {
+		log.Printf("⚡ Ofertas flash: %d iniciadas, %d expiradas", started.RowsAffected, expired.RowsAffected)
+	}
+	return nil
+}
+
+// claimOffer consume una unidad de stock de una oferta flash en curso (atómico)
+func claimOffer(c *gin.Context) {
+	if !isUUID(c.Param("id")) {
+		c.JSON(404, gin.H{"error": "Oferta no encontrada"})
+		return
+	}
+	var remaining *int64
+	res := db.Raw(`
+		UPDATE offers SET stock_remaining = stock_remaining - 1, updated_at = NOW()
+		WHERE id = ? AND status = ? AND ends_at > NOW()
+		AND (stock_remaining IS NULL OR stock_remaining > 0)
+		RETURNING stock_remaining`, c.Param("id"), OfferFlash).Scan(&remaining)
+	if res.Error != nil {
+		c.JSON(500, gin.H{"error": "Error reclamando oferta"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(409, gin.H{"error": "Oferta agotada o fuera de horario"})
+		return
+	}
+
+	// Última unidad: se expira sin esperar al job
+	if remaining != nil && *remaining <= 0 {
+		db.Model(&Offer{}).Where("id = ?", c.Param("id")).
+			Updates(map[string]interface{}{"status": OfferExpired, "updated_at": time.Now()})
+	}
+	log.Printf("⚡ Oferta %s reclamada por %s", c.Param("id"), currentUserID(c))
+	c.JSON(200, gin.H{"message": "Oferta reclamada", "remaining_stock": remaining})
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // Decodificador PNG para image.Decode
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// --- FOTOS DE CAPTURAS (Validación, EXIF y miniaturas) ---
+
+// PhotoConfig límites de las fotos subidas
+type PhotoConfig struct {
+	MaxBytes          int64   // PHOTO_MAX_BYTES
+	MinSide           int     // Lado mínimo en píxeles
+	MaxSide           int     // Lado máximo (evita bombas de descompresión)
+	GPSMaxDistanceM   float64 // PHOTO_GPS_MAX_DISTANCE_M: tolerancia EXIF vs coordenadas enviadas
+	HashMaxDistance   int     // PHOTO_HASH_MAX_DISTANCE: bits distintos para considerar dos fotos iguales (máx. 15)
+	ThumbSide         int
+	MediumSide        int
+	JPEGQuality       int
+	ThumbJPEGQuality  int
+	allowedMediaTypes map[string]bool
+}
+
+var photoConfig = PhotoConfig{
+	MaxBytes:         10 << 20,
+	MinSide:          320,
+	MaxSide:          8000,
+	GPSMaxDistanceM:  300,
+	HashMaxDistance:  6,
+	ThumbSide:        200,
+	MediumSide:       800,
+	JPEGQuality:      85,
+	ThumbJPEGQuality: 75,
+	allowedMediaTypes: map[string]bool{
+		"image/jpeg": true,
+		"image/png":  true,
+	},
+}
+
+var (
+	errPhotoTooLarge  = errors.New("la foto supera el tamaño máximo")
+	errPhotoType      = errors.New("formato de foto no soportado (usa JPEG o PNG)")
+	errPhotoDims      = errors.New("dimensiones de foto fuera de rango")
+	errPhotoCorrupted = errors.New("la foto está dañada")
+)
+
+// processedPhoto renditions listas para subir (todas JPEG sin metadatos)
+type processedPhoto struct {
+	Original []byte
+	Medium   []byte
+	Thumb    []byte
+	Width    int
+	Height   int
+	GPS      *gpsPoint // Coordenadas EXIF, si la foto las traía
+	Hash     int64     // dHash de 64 bits (ver photoDHash)
+}
+
+type gpsPoint struct {
+	Lat float64
+	Lng float64
+}
+
+// readPhoto lee la foto completa respetando el límite de tamaño
+func readPhoto(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, photoConfig.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > photoConfig.MaxBytes {
+		return nil, errPhotoTooLarge
+	}
+	return data, nil
+}
+
+// processPhoto valida el contenido real y genera las renditions.
+// Reencodear a JPEG elimina todo el EXIF (privacidad); la orientación se aplica antes.
+func processPhoto(data []byte) (*processedPhoto, error) {
+	if !photoConfig.allowedMediaTypes[http.DetectContentType(data)] {
+		return nil, errPhotoType
+	}
+
+	// Dimensiones sin decodificar la imagen entera
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errPhotoCorrupted
+	}
+	if cfg.Width < photoConfig.MinSide && cfg.Height < photoConfig.MinSide ||
+		cfg.Width > photoConfig.MaxSide || cfg.Height > photoConfig.MaxSide {
+		return nil, errPhotoDims
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errPhotoCorrupted
+	}
+
+	meta := parseEXIF(data)
+	img = applyOrientation(img, meta.Orientation)
+
+	out := &processedPhoto{
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		GPS:    meta.GPS,
+		Hash:   photoDHash(img),
+	}
+	if out.Original, err = encodeJPEG(img, photoConfig.JPEGQuality); err != nil {
+		return nil, err
+	}
+	if out.Medium, err = encodeJPEG(fitWithin(img, photoConfig.MediumSide), photoConfig.JPEGQuality); err != nil {
+		return nil, err
+	}
+	if out.Thumb, err = encodeJPEG(fitWithin(img, photoConfig.ThumbSide), photoConfig.ThumbJPEGQuality); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fitWithin reduce la imagen (promedio por área) para que su lado mayor sea 'side'
+func fitWithin(src image.Image, side int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= side && h <= side {
+		return src
+	}
+	scale := float64(side) / float64(max(w, h))
+	dw, dh := max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy0, sy1 := b.Min.Y+y*h/dh, b.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			sx0, sx1 := b.Min.X+x*w/dw, b.Min.X+(x+1)*w/dw
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < max(sy1, sy0+1); sy++ {
+				for sx := sx0; sx < max(sx1, sx0+1); sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
+
+// photoDHash hash perceptual (dHash): escala a 9x8 en grises y compara cada píxel con su vecino.
+// Sobrevive a recompresión, cambios de tamaño y ajustes leves de brillo.
+func photoDHash(src image.Image) int64 {
+	const w, h = 9, 8
+	b := src.Bounds()
+	var gray [h][w]float64
+	for y := 0; y < h; y++ {
+		sy0, sy1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			sx0, sx1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			// Muestreo con paso para no recorrer todos los píxeles de fotos grandes
+			stepY, stepX := max(1, (sy1-sy0)/16), max(1, (sx1-sx0)/16)
+			var sum, n float64
+			for sy := sy0; sy < max(sy1, sy0+1); sy += stepY {
+				for sx := sx0; sx < max(sx1, sx0+1); sx += stepX {
+					r, g, bl, _ := src.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+					n++
+				}
+			}
+			gray[y][x] = sum / n
+		}
+	}
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return int64(hash) // Postgres no tiene uint64: se guarda el patrón de bits en un bigint
+}
+
+// applyOrientation corrige la rotación indicada por el tag EXIF Orientation (1..8)
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Espejo horizontal
+				dx, dy = w-1-x, y
+			case 3: // 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Espejo vertical
+				dx, dy = x, h-1-y
+			case 5: // Transpuesta
+				dx, dy = y, x
+			case 6: // 90° horario
+				dx, dy = h-1-y, x
+			case 7: // Transversa
+				dx, dy = h-1-y, w-1-x
+			case 8: // 90° antihorario
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// --- EXIF (solo lo necesario: orientación y GPS) ---
+
+type exifMeta struct {
+	Orientation int
+	GPS         *gpsPoint
+}
+
+// parseEXIF busca el segmento APP1 "Exif" de un JPEG. Nunca falla: sin EXIF devuelve vacío.
+func parseEXIF(data []byte) exifMeta {
+	var meta exifMeta
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return meta
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return meta
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // Inicio de imagen comprimida: ya no hay metadatos
+			return meta
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + size
+		if size < 2 || end > len(data) {
+			return meta
+		}
+		seg := data[i+4 : end]
+		if marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			parseTIFF(seg[6:], &meta)
+			return meta
+		}
+		i = end
+	}
+	return meta
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func (t *tiffReader) u8(off int) (byte, bool) {
+	if off < 0 || off >= len(t.data) {
+		return 0, false
+	}
+	return t.data[off], true
+}
+
+func (t *tiffReader) u16(off int) (uint16, bool) {
+	if off < 0 || off+2 > len(t.data) {
+		return 0, false
+	}
+	return t.order.Uint16(t.data[off:]), true
+}
+
+func (t *tiffReader) u32(off int) (uint32, bool) {
+	if off < 0 || off+4 > len(t.data) {
+		return 0, false
+	}
+	return t.order.Uint32(t.data[off:]), true
+}
+
+// ifdEntries devuelve tag -> offset de la entrada (12 bytes) dentro del IFD
+func (t *tiffReader) ifdEntries(off int) map[uint16]int {
+	entries := map[uint16]int{}
+	n, ok := t.u16(off)
+	if !ok || n > 512 {
+		return entries
+	}
+	for i := 0; i < int(n); i++ {
+		e := off + 2 + i*12
+		tag, ok := t.u16(e)
+		if !ok {
+			break
+		}
+		entries[tag] = e
+	}
+	return entries
+}
+
+// rationals lee 'count' RATIONAL apuntados por la entrada
+func (t *tiffReader) rationals(entry, count int) ([]float64, bool) {
+	off, ok := t.u32(entry + 8)
+	if !ok {
+		return nil, false
+	}
+	out := make([]float64, count)
+	for i := range out {
+		num, ok1 := t.u32(int(off) + i*8)
+		den, ok2 := t.u32(int(off) + i*8 + 4)
+		if !ok1 || !ok2 || den == 0 {
+			return nil, false
+		}
+		out[i] = float64(num) / float64(den)
+	}
+	return out, true
+}
+
+func parseTIFF(data []byte, meta *exifMeta) {
+	if len(data) < 8 {
+		return
+	}
+	t := &tiffReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return
+	}
+	ifd0, ok := t.u32(4)
+	if !ok {
+		return
+	}
+	entries := t.ifdEntries(int(ifd0))
+
+	if e, ok := entries[0x0112]; ok { // Orientation (SHORT)
+		if v, ok := t.u16(e + 8); ok {
+			meta.Orientation = int(v)
+		}
+	}
+
+	e, ok := entries[0x8825] // Puntero al GPS IFD
+	if !ok {
+		return
+	}
+	gpsOff, ok := t.u32(e + 8)
+	if !ok {
+		return
+	}
+	gps := t.ifdEntries(int(gpsOff))
+	latRefE, ok1 := gps[0x0001]
+	latE, ok2 := gps[0x0002]
+	lngRefE, ok3 := gps[0x0003]
+	lngE, ok4 := gps[0x0004]
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return
+	}
+	lat, ok1 := t.rationals(latE, 3)
+	lng, ok2 := t.rationals(lngE, 3)
+	if !ok1 || !ok2 {
+		return
+	}
+	// Las referencias (N/S, E/W) caben en el propio campo de valor; sin ellas no hay GPS
+	latRef, ok1 := t.u8(latRefE + 8)
+	lngRef, ok2 := t.u8(lngRefE + 8)
+	if !ok1 || !ok2 {
+		return
+	}
+
+	p := gpsPoint{
+		Lat: lat[0] + lat[1]/60 + lat[2]/3600,
+		Lng: lng[0] + lng[1]/60 + lng[2]/3600,
+	}
+	if latRef == 'S' {
+		p.Lat = -p.Lat
+	}
+	if lngRef == 'W' {
+		p.Lng = -p.Lng
+	}
+	if p.Lat == 0 && p.Lng == 0 || math.Abs(p.Lat) > 90 || math.Abs(p.Lng) > 180 {
+		return // Muchos teléfonos escriben 0,0 cuando no tienen fix
+	}
+	meta.GPS = &p
+}
+
+// haversineMeters distancia aproximada entre dos puntos WGS84
+func haversineMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadius = 6371000.0
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat, dLng := toRad(lat2-lat1), toRad(lng2-lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// photoErrorStatus traduce los errores de validación a códigos HTTP
+func photoErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, errPhotoTooLarge):
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("La foto supera %d MB", photoConfig.MaxBytes>>20)
+	case errors.Is(err, errPhotoType), errors.Is(err, errPhotoDims), errors.Is(err, errPhotoCorrupted):
+		return http.StatusBadRequest, err.Error()
+	}
+	return http.StatusInternalServerError, "Error procesando la foto"
+}
+
+// Búsqueda por bandas (multi-index hashing): el dHash se parte en 4 bandas de 16 bits.
+// Si dos hashes difieren en d bits, al menos una banda difiere en d/4 bits o menos,
+// así que basta con buscar cada banda y sus vecinas a ese radio (columna photo_hash_bands).
+const (
+	photoHashBands     = 4
+	photoHashBandBits  = 16
+	maxPhotoHashRadius = 3 // Radio por banda: hasta 697 vecinas por banda
+)
+
+// photoHashProbe claves de banda a consultar para encontrar hashes a <= maxDistance bits
+func photoHashProbe(hash int64, maxDistance int) []int {
+	radius := maxDistance / photoHashBands
+	if radius > maxPhotoHashRadius {
+		radius = maxPhotoHashRadius
+	}
+	var keys []int
+	for band := 0; band < photoHashBands; band++ {
+		v := int(uint64(hash)>>(band*photoHashBandBits)) & (1<<photoHashBandBits - 1)
+		for _, n := range bitNeighbors(v, radius, 0) {
+			keys = append(keys, band<<photoHashBandBits|n)
+		}
+	}
+	return keys
+}
+
+// bitNeighbors valores de 16 bits a distancia de Hamming <= radius de v (cambiando bits desde 'from')
+func bitNeighbors(v, radius, from int) []int {
+	out := []int{v}
+	if radius == 0 {
+		return out
+	}
+	for b := from; b < photoHashBandBits; b++ {
+		out = append(out, bitNeighbors(v^(1<<b), radius-1, b+1)...)
+	}
+	return out
+}
+
+// similarPhoto busca la captura existente con la foto más parecida (distancia de Hamming entre dHash).
+// No depende de la ubicación: detecta la misma foto subida desde otro punto o con otra categoría.
+// Solo se comparan los candidatos que comparten alguna banda (índice GIN), no toda la tabla.
+func similarPhoto(tx *gorm.DB, hash int64) (id string, distance int, found bool, err error) {
+	keys := photoHashProbe(hash, photoConfig.HashMaxDistance)
+	probe := make([]string, len(keys))
+	for i, k := range keys {
+		probe[i] = strconv.Itoa(k)
+	}
+
+	var row struct {
+		ID       string
+		Distance int
+	}
+	// bit(64) -> texto de ceros y unos; contar los '1' del XOR da la distancia
+	res := tx.Raw(`
+		SELECT id, length(replace(((photo_hash # ?)::bit(64))::text, '0', '')) AS distance
+		FROM locations
+		WHERE photo_hash_bands && ?::integer[]
+		AND photo_hash IS NOT NULL AND status NOT IN ('rejected', 'merged')
+		ORDER BY distance ASC, created_at ASC
+		LIMIT 1`, hash, "{"+strings.Join(probe, ",")+"}").Scan(&row)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return "", 0, false, res.Error
+	}
+	return row.ID, row.Distance, row.Distance <= photoConfig.HashMaxDistance, nil
+}
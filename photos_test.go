@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// gpsTIFF arma un bloque TIFF little-endian con IFD0 -> GPS IFD.
+// La entrada GPSLongitudeRef (0x0003) va al final para poder truncarla.
+func gpsTIFF() (data []byte, lngRefEntry int) {
+	le := binary.LittleEndian
+	buf := make([]byte, 128)
+	copy(buf, "II")
+	le.PutUint16(buf[2:], 42)
+	le.PutUint32(buf[4:], 8)
+
+	entry := func(off int, tag, typ uint16, count, value uint32) {
+		le.PutUint16(buf[off:], tag)
+		le.PutUint16(buf[off+2:], typ)
+		le.PutUint32(buf[off+4:], count)
+		le.PutUint32(buf[off+8:], value)
+	}
+
+	// IFD0: solo el puntero al GPS IFD
+	le.PutUint16(buf[8:], 1)
+	entry(10, 0x8825, 4, 1, 74)
+
+	// 10° 30' 0" y 66° 54' 0" como RATIONAL
+	rational := func(off int, vals ...uint32) {
+		for i, v := range vals {
+			le.PutUint32(buf[off+i*8:], v)
+			le.PutUint32(buf[off+i*8+4:], 1)
+		}
+	}
+	rational(26, 10, 30, 0)
+	rational(50, 66, 54, 0)
+
+	le.PutUint16(buf[74:], 4)
+	entry(76, 0x0001, 2, 2, uint32('N'))
+	entry(88, 0x0002, 5, 3, 26)
+	entry(100, 0x0004, 5, 3, 50)
+	entry(112, 0x0003, 2, 2, uint32('W'))
+	return buf, 112
+}
+
+func TestParseTIFFGPS(t *testing.T) {
+	data, _ := gpsTIFF()
+	var meta exifMeta
+	parseTIFF(data, &meta)
+	if meta.GPS == nil {
+		t.Fatal("esperaba coordenadas GPS")
+	}
+	if math.Abs(meta.GPS.Lat-10.5) > 1e-9 || math.Abs(meta.GPS.Lng+66.9) > 1e-9 {
+		t.Fatalf("GPS inesperado: %+v", *meta.GPS)
+	}
+}
+
+func TestParseTIFFTruncatedGPSRef(t *testing.T) {
+	data, lngRefEntry := gpsTIFF()
+	// La etiqueta de la entrada cabe, pero su campo de valor no
+	truncated := data[:lngRefEntry+4]
+
+	var meta exifMeta
+	parseTIFF(truncated, &meta) // No debe entrar en pánico
+	if meta.GPS != nil {
+		t.Fatalf("esperaba sin GPS, obtuve %+v", *meta.GPS)
+	}
+}
+
+// photoHashBandKeys replica la columna generada photo_hash_bands
+func photoHashBandKeys(hash int64) []int {
+	keys := make([]int, photoHashBands)
+	for band := range keys {
+		keys[band] = band<<photoHashBandBits | int(uint64(hash)>>(band*photoHashBandBits))&0xffff
+	}
+	return keys
+}
+
+func TestPhotoHashProbeFindsCloseHashes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for maxDist := 0; maxDist < photoHashBands*(maxPhotoHashRadius+1); maxDist++ {
+		for i := 0; i < 50; i++ {
+			hash := int64(rng.Uint64())
+			probe := map[int]bool{}
+			for _, k := range photoHashProbe(hash, maxDist) {
+				probe[k] = true
+			}
+
+			// Otra foto a exactamente maxDist bits
+			other := uint64(hash)
+			for _, b := range rng.Perm(64)[:maxDist] {
+				other ^= 1 << b
+			}
+			hit := false
+			for _, k := range photoHashBandKeys(int64(other)) {
+				hit = hit || probe[k]
+			}
+			if !hit {
+				t.Fatalf("distancia %d: %x no encontró a %x", maxDist, uint64(hash), other)
+			}
+		}
+	}
+}
+
+func TestPhotoHashProbeSize(t *testing.T) {
+	// Radio 1 por banda: el valor propio + 16 vecinas
+	if n := len(photoHashProbe(0x0123456789abcdef, 6)); n != photoHashBands*17 {
+		t.Fatalf("esperaba %d claves, obtuve %d", photoHashBands*17, n)
+	}
+}
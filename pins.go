@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- PIN DIARIO (HMAC estilo TOTP) ---
+
+// PINConfig parámetros de generación y bloqueo de PINs
+type PINConfig struct {
+	Secret []byte // PIN_SECRET: nunca sale del servidor
+	Length int    // Dígitos del PIN (PIN_LENGTH, 4..9)
+
+	UserMaxFailures    int           // Fallos antes de bloquear al usuario
+	StationMaxFailures int           // Fallos (de cualquier usuario) antes de bloquear la estación
+	StationMinUsers    int           // Usuarios distintos que deben fallar para bloquear la estación
+	BaseLockout        time.Duration // Primer bloqueo; se duplica en cada fallo adicional
+	MaxLockout         time.Duration
+	FailureWindow      time.Duration // Sin fallos (ni bloqueo vigente) durante este tiempo, el contador vuelve a 0
+}
+
+var pinConfig = PINConfig{
+	Length:             6,
+	UserMaxFailures:    5,
+	StationMaxFailures: 20,
+	StationMinUsers:    3,
+	BaseLockout:        30 * time.Second,
+	MaxLockout:         24 * time.Hour,
+	FailureWindow:      15 * time.Minute,
+}
+
+// derivePIN calcula el PIN de una estación para una fecha local (YYYY-MM-DD).
+// 'epoch' cuenta las rotaciones forzadas del día (0 = PIN normal).
+// Mismo truncado dinámico que HOTP (RFC 4226) sobre HMAC-SHA256.
+func derivePIN(secret []byte, stationID, date string, epoch, length int) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(fmt.Sprintf("%s|%s|%d", stationID, date, epoch)))
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(math.Pow10(length))
+	return fmt.Sprintf("%0*d", length, code%mod)
+}
+
+// stationTZ zona horaria de la estación (UTC si no es válida)
+func stationTZ(loc *Location) *time.Location {
+	if tz, err := time.LoadLocation(loc.Timezone); err == nil && loc.Timezone != "" {
+		return tz
+	}
+	return time.UTC
+}
+
+// localDate fecha local de la estación en formato YYYY-MM-DD
+func localDate(loc *Location, t time.Time) string {
+	return t.In(stationTZ(loc)).Format("2006-01-02")
+}
+
+// pinIsCurrent indica si el PIN guardado corresponde al día local actual
+func pinIsCurrent(loc *Location, now time.Time) bool {
+	return loc.DailyPIN != "" && localDate(loc, loc.PINUpdatedAt) == localDate(loc, now)
+}
+
+// currentStationPIN devuelve el PIN vigente sin escribir en DB.
+// Si el job aún no rotó (p.ej. segundos después de medianoche), se deriva el del día.
+func currentStationPIN(loc *Location, now time.Time) string {
+	if pinIsCurrent(loc, now) {
+		return loc.DailyPIN
+	}
+	return derivePIN(pinConfig.Secret, loc.ID, localDate(loc, now), 0, pinConfig.Length)
+}
+
+// rotateStationPIN guarda un PIN nuevo. Con force=true sube el epoch del día (PIN filtrado).
+func rotateStationPIN(tx *gorm.DB, loc *Location, now time.Time, force bool) error {
+	epoch := 0
+	if force && pinIsCurrent(loc, now) {
+		epoch = loc.PINEpoch + 1
+	} else if force {
+		epoch = 1
+	}
+	pin := derivePIN(pinConfig.Secret, loc.ID, localDate(loc, now), epoch, pinConfig.Length)
+	if err := tx.Model(loc).Updates(map[string]interface{}{
+		"daily_pin":      pin,
+		"pin_epoch":      epoch,
+		"pin_updated_at": now,
+	}).Error; err != nil {
+		return err
+	}
+	loc.DailyPIN, loc.PINEpoch, loc.PINUpdatedAt = pin, epoch, now
+	return nil
+}
+
+// rotateDuePINs (job) rota las estaciones cuyo día local ya cambió
+func rotateDuePINs(ctx context.Context) error {
+	var stations []Location
+	if err := db.WithContext(ctx).
+		Select("id", "timezone", "daily_pin", "pin_epoch", "pin_updated_at").
+		Where("category IN ? AND status IS DISTINCT FROM ?", []string{"station_moto", "station_car"}, LocationMerged).
+		Find(&stations).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rotated := 0
+	for i := range stations {
+		if pinIsCurrent(&stations[i], now) {
+			continue
+		}
+		if err := rotateStationPIN(db.WithContext(ctx), &stations[i], now, false); err != nil {
+			log.Printf("❌ Error rotando PIN de %s: %v", stations[i].ID, err)
+			continue
+		}
+		rotated++
+	}
+	if rotated > 0 {
+		log.Printf("🔑 PINs rotados: %d", rotated)
+	}
+	return nil
+}
+
+// forceRotatePIN (admin) invalida el PIN del día de una estación
+func forceRotatePIN(c *gin.Context) {
+	var loc Location
+	if err := db.First(&loc, "id = ? AND category IN ?", c.Param("id"), []string{"station_moto", "station_car"}).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Estación no encontrada"})
+		return
+	}
+	if err := rotateStationPIN(db, &loc, time.Now(), true); err != nil {
+		c.JSON(500, gin.H{"error": "Error rotando PIN"})
+		return
+	}
+	log.Printf("🔑 PIN de %s rotado manualmente por %s", loc.ID, currentUserID(c))
+	c.JSON(200, gin.H{"message": "PIN rotado", "station_id": loc.ID, "pin_updated_at": loc.PINUpdatedAt})
+}
+
+// --- BLOQUEO Y AUDITORÍA ---
+
+const (
+	LockScopeUser    = "user"
+	LockScopeStation = "station"
+)
+
+// PINLockout contador de fallos consecutivos por usuario o por estación
+type PINLockout struct {
+	Scope       string    `gorm:"primaryKey" json:"scope"`   // 'user' o 'station'
+	Subject     string    `gorm:"primaryKey" json:"subject"` // UID o ID de estación
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PINAttempt (Auditoría de cada intento de activación)
+type PINAttempt struct {
+	ID        string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	UserID    string    `gorm:"index" json:"user_id"`
+	StationID string    `gorm:"index" json:"station_id"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"` // 'ok', 'wrong_pin', 'locked'
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// lockoutFor duración del bloqueo tras 'failures' fallos (0 si aún no toca bloquear)
+func lockoutFor(failures, max int) time.Duration {
+	if failures < max {
+		return 0
+	}
+	d := pinConfig.BaseLockout << uint(failures-max)
+	if d <= 0 || d > pinConfig.MaxLockout {
+		return pinConfig.MaxLockout
+	}
+	return d
+}
+
+// pinLockedUntil devuelve hasta cuándo está bloqueado el usuario o la estación
+func pinLockedUntil(tx *gorm.DB, userID, stationID string) (time.Time, error) {
+	var locks []PINLockout
+	err := tx.Where("(scope = ? AND subject = ?) OR (scope = ? AND subject = ?)",
+		LockScopeUser, userID, LockScopeStation, stationID).Find(&locks).Error
+	var until time.Time
+	for _, l := range locks {
+		if l.LockedUntil.After(until) {
+			until = l.LockedUntil
+		}
+	}
+	return until, err
+}
+
+// registerPINFailure suma un fallo a ambos contadores y recalcula el bloqueo.
+// Llamar después de auditar el intento: el bloqueo de estación cuenta usuarios distintos en pin_attempts.
+func registerPINFailure(tx *gorm.DB, userID, stationID string) error {
+	now := time.Now()
+	quietSince := now.Add(-pinConfig.FailureWindow)
+	for _, k := range []struct {
+		scope, subject string
+		max            int
+	}{
+		{LockScopeUser, userID, pinConfig.UserMaxFailures},
+		{LockScopeStation, stationID, pinConfig.StationMaxFailures},
+	} {
+		// Upsert atómico: dos intentos simultáneos no pueden perder un fallo.
+		// Tras FailureWindow sin fallos y sin bloqueo vigente se empieza de nuevo.
+		var failures int
+		err := tx.Raw(`
+			INSERT INTO pin_lockouts (scope, subject, failures, updated_at) VALUES (?, ?, 1, ?)
+			ON CONFLICT (scope, subject)
+			DO UPDATE SET
+				failures = CASE
+					WHEN pin_lockouts.updated_at < ? AND COALESCE(pin_lockouts.locked_until, '-infinity') <= ? THEN 1
+					ELSE pin_lockouts.failures + 1
+				END,
+				updated_at = EXCLUDED.updated_at
+			RETURNING failures`, k.scope, k.subject, now, quietSince, now).Scan(&failures).Error
+		if err != nil {
+			return err
+		}
+		d := lockoutFor(failures, k.max)
+		if d > 0 && k.scope == LockScopeStation {
+			// Un solo usuario no puede bloquear la estación para todos
+			var users int64
+			if err := tx.Model(&PINAttempt{}).
+				Where("station_id = ? AND reason = ? AND created_at >= ?", stationID, "wrong_pin", quietSince).
+				Distinct("user_id").Count(&users).Error; err != nil {
+				return err
+			}
+			if users < int64(pinConfig.StationMinUsers) {
+				d = 0
+			}
+		}
+		if d > 0 {
+			if err := tx.Model(&PINLockout{}).Where("scope = ? AND subject = ?", k.scope, k.subject).
+				Update("locked_until", now.Add(d)).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resetPINFailures limpia los contadores tras una activación correcta
+func resetPINFailures(tx *gorm.DB, userID, stationID string) error {
+	return tx.Where("(scope = ? AND subject = ?) OR (scope = ? AND subject = ?)",
+		LockScopeUser, userID, LockScopeStation, stationID).Delete(&PINLockout{}).Error
+}
+
+func auditPINAttempt(tx *gorm.DB, userID, stationID, ip, reason string) error {
+	return tx.Create(&PINAttempt{
+		UserID:    userID,
+		StationID: stationID,
+		Success:   reason == "ok",
+		Reason:    reason,
+		IP:        ip,
+		CreatedAt: time.Now(),
+	}).Error
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- REGLAS DE PUNTOS POR CAPTURA ---
+//
+// Puntos = base × multiplicadores + bonos.
+// - base: gana la regla base aplicable de mayor prioridad (si no hay ninguna, defaultCapturePoints).
+// - multiplier: se aplican todas las que encajen (p.ej. zona poco mapeada).
+// - bonus: se suman todas las que encajen (p.ej. buena foto, primero en la zona).
+
+const (
+	PointsRuleBase       = "base"
+	PointsRuleMultiplier = "multiplier"
+	PointsRuleBonus      = "bonus"
+)
+
+// Condiciones extra que se evalúan contra la captura
+const (
+	PointsCondUnderMapped  = "under_mapped"  // Pocos puntos en RadiusM (<= Threshold)
+	PointsCondPhotoQuality = "photo_quality" // Foto con lado corto >= Threshold px, GPS coherente y no repetida
+	PointsCondFirstInZone  = "first_in_zone" // Ningún punto de la misma categoría en RadiusM
+)
+
+var pointsRuleKinds = map[string]bool{PointsRuleBase: true, PointsRuleMultiplier: true, PointsRuleBonus: true}
+
+var pointsConditions = map[string]bool{"": true, PointsCondUnderMapped: true, PointsCondPhotoQuality: true, PointsCondFirstInZone: true}
+
+// Sin reglas base aplicables se paga lo de siempre
+const defaultCapturePoints = 10
+
+// Radio por defecto de las condiciones de zona
+const defaultPointsRuleRadius = 500
+
+// PointsRule (Regla configurable de puntos por captura)
+type PointsRule struct {
+	ID          string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	Name        string     `json:"name"`
+	Kind        string     `json:"kind"`         // 'base', 'multiplier', 'bonus'
+	Value       float64    `json:"value"`        // Puntos (base/bonus) o factor (multiplier)
+	Priority    int        `json:"priority"`     // Desempate entre reglas base
+	Category    string     `json:"category"`     // Vacío = cualquiera
+	VehicleType string     `json:"vehicle_type"` // Vacío = cualquiera
+	ZoneLat     *float64   `json:"zone_lat"`     // Zona circular opcional
+	ZoneLng     *float64   `json:"zone_lng"`
+	ZoneRadiusM *float64   `json:"zone_radius_m"`
+	StartsAt    *time.Time `json:"starts_at"` // Vigencia (campañas)
+	EndsAt      *time.Time `json:"ends_at"`
+	HourFrom    *int       `json:"hour_from"` // Franja diaria [from, to) en hora del servidor; puede cruzar medianoche
+	HourTo      *int       `json:"hour_to"`
+	Condition   string     `json:"condition"` // Vacío, 'under_mapped', 'photo_quality', 'first_in_zone'
+	RadiusM     float64    `json:"radius_m"`  // Para under_mapped / first_in_zone
+	Threshold   float64    `json:"threshold"` // Máximo de puntos cercanos (under_mapped) o lado mínimo en px (photo_quality)
+	Active      bool       `json:"active"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// captureContext lo que las reglas pueden mirar de una captura
+type captureContext struct {
+	LocationID  string // Ya insertada: se excluye de los conteos de zona
+	Category    string
+	VehicleType string
+	Lat, Lng    float64
+	At          time.Time
+	Photo       *processedPhoto
+	GPSMismatch bool
+	PhotoRepeat bool // Foto casi idéntica a otra captura
+}
+
+// PointsRuleHit regla que se aplicó y cuánto aportó
+type PointsRuleHit struct {
+	RuleID string  `json:"rule_id,omitempty"` // Vacío = valor por defecto
+	Name   string  `json:"name"`
+	Kind   string  `json:"kind"`
+	Value  float64 `json:"value"`
+	Points float64 `json:"points"` // Aporte al total
+}
+
+// PointsAward resultado del motor de reglas
+type PointsAward struct {
+	Total float64         `json:"total"`
+	Rules []PointsRuleHit `json:"rules"`
+}
+
+// matchesStatic filtros que no necesitan consultar la base
+func (r *PointsRule) matchesStatic(cc *captureContext) bool {
+	if r.Category != "" && r.Category != cc.Category {
+		return false
+	}
+	if r.VehicleType != "" && r.VehicleType != cc.VehicleType {
+		return false
+	}
+	if r.StartsAt != nil && cc.At.Before(*r.StartsAt) {
+		return false
+	}
+	if r.EndsAt != nil && !cc.At.Before(*r.EndsAt) {
+		return false
+	}
+	if r.HourFrom != nil && r.HourTo != nil {
+		h, from, to := cc.At.Hour(), *r.HourFrom, *r.HourTo
+		if from <= to && (h < from || h >= to) {
+			return false
+		}
+		if from > to && h < from && h >= to {
+			return false
+		}
+	}
+	if r.ZoneLat != nil && r.ZoneLng != nil && r.ZoneRadiusM != nil {
+		if haversineMeters(cc.Lat, cc.Lng, *r.ZoneLat, *r.ZoneLng) > *r.ZoneRadiusM {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesCondition evalúa la condición extra (puede consultar la base)
+func (r *PointsRule) matchesCondition(tx *gorm.DB, cc *captureContext) (bool, error) {
+	radius := r.RadiusM
+	if radius <= 0 {
+		radius = defaultPointsRuleRadius
+	}
+	switch r.Condition {
+	case PointsCondUnderMapped:
+		n, err := nearbyCaptures(tx, cc, radius, "")
+		return err == nil && float64(n) <= r.Threshold, err
+	case PointsCondFirstInZone:
+		n, err := nearbyCaptures(tx, cc, radius, cc.Category)
+		return err == nil && n == 0, err
+	case PointsCondPhotoQuality:
+		if cc.Photo == nil || cc.GPSMismatch || cc.PhotoRepeat {
+			return false, nil
+		}
+		return float64(min(cc.Photo.Width, cc.Photo.Height)) >= r.Threshold, nil
+	}
+	return true, nil
+}
+
+// nearbyCaptures cuenta puntos vivos alrededor de la captura (sin contarla a ella)
+func nearbyCaptures(tx *gorm.DB, cc *captureContext, radius float64, category string) (int64, error) {
+	q := tx.Model(&Location{}).
+		Where("status NOT IN ?", []string{"rejected", LocationMerged}).
+		Where("id <> ?", cc.LocationID).
+		Where("ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)", cc.Lng, cc.Lat, radius)
+	if category != "" {
+		q = q.Where("category = ?", category)
+	}
+	var n int64
+	err := q.Count(&n).Error
+	return n, err
+}
+
+// capturePoints aplica las reglas activas a la captura. Se llama dentro de la transacción de la captura.
+func capturePoints(tx *gorm.DB, cc *captureContext) (*PointsAward, error) {
+	var rules []PointsRule
+	if err := tx.Where("active = ?", true).Order("priority DESC, created_at ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	var base *PointsRule
+	var multipliers, bonuses []*PointsRule
+	for i := range rules {
+		r := &rules[i]
+		if !r.matchesStatic(cc) {
+			continue
+		}
+		if r.Kind == PointsRuleBase && base != nil {
+			continue // Ya ganó una base de mayor prioridad
+		}
+		ok, err := r.matchesCondition(tx, cc)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		switch r.Kind {
+		case PointsRuleBase:
+			base = r
+		case PointsRuleMultiplier:
+			multipliers = append(multipliers, r)
+		case PointsRuleBonus:
+			bonuses = append(bonuses, r)
+		}
+	}
+
+	award := &PointsAward{}
+	if base != nil {
+		award.Total = base.Value
+		award.Rules = append(award.Rules, PointsRuleHit{RuleID: base.ID, Name: base.Name, Kind: base.Kind, Value: base.Value, Points: base.Value})
+	} else {
+		award.Total = defaultCapturePoints
+		award.Rules = append(award.Rules, PointsRuleHit{Name: "Captura", Kind: PointsRuleBase, Value: defaultCapturePoints, Points: defaultCapturePoints})
+	}
+	for _, r := range multipliers {
+		before := award.Total
+		award.Total *= r.Value
+		award.Rules = append(award.Rules, PointsRuleHit{RuleID: r.ID, Name: r.Name, Kind: r.Kind, Value: r.Value, Points: roundPoints(award.Total - before)})
+	}
+	for _, r := range bonuses {
+		award.Total += r.Value
+		award.Rules = append(award.Rules, PointsRuleHit{RuleID: r.ID, Name: r.Name, Kind: r.Kind, Value: r.Value, Points: r.Value})
+	}
+	award.Total = roundPoints(award.Total)
+	return award, nil
+}
+
+func roundPoints(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// --- ADMINISTRACIÓN ---
+
+type pointsRuleRequest struct {
+	Name        string     `json:"name"`
+	Kind        string     `json:"kind"`
+	Value       float64    `json:"value"`
+	Priority    int        `json:"priority"`
+	Category    string     `json:"category"`
+	VehicleType string     `json:"vehicle_type"`
+	ZoneLat     *float64   `json:"zone_lat"`
+	ZoneLng     *float64   `json:"zone_lng"`
+	ZoneRadiusM *float64   `json:"zone_radius_m"`
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	HourFrom    *int       `json:"hour_from"`
+	HourTo      *int       `json:"hour_to"`
+	Condition   string     `json:"condition"`
+	RadiusM     float64    `json:"radius_m"`
+	Threshold   float64    `json:"threshold"`
+	Active      *bool      `json:"active"`
+}
+
+func (req *pointsRuleRequest) validate() string {
+	switch {
+	case req.Name == "":
+		return "Falta el nombre de la regla"
+	case !pointsRuleKinds[req.Kind]:
+		return "kind debe ser base, multiplier o bonus"
+	case req.Value <= 0 || math.IsNaN(req.Value) || math.IsInf(req.Value, 0):
+		return "value debe ser mayor que 0"
+	case req.Category != "" && !huntCategories[req.Category]:
+		return "Categoría no permitida: " + req.Category
+	case req.VehicleType != "" && req.VehicleType != "moto" && req.VehicleType != "car":
+		return "vehicle_type debe ser moto o car"
+	case !pointsConditions[req.Condition]:
+		return "condition debe ser under_mapped, photo_quality o first_in_zone"
+	case req.RadiusM < 0 || req.Threshold < 0:
+		return "radius_m y threshold no pueden ser negativos"
+	}
+	zone := []bool{req.ZoneLat != nil, req.ZoneLng != nil, req.ZoneRadiusM != nil}
+	if zone[0] != zone[1] || zone[1] != zone[2] {
+		return "La zona necesita zone_lat, zone_lng y zone_radius_m"
+	}
+	if zone[0] && (!validCoords(*req.ZoneLat, *req.ZoneLng) || *req.ZoneRadiusM <= 0) {
+		return "Zona inválida"
+	}
+	if (req.HourFrom == nil) != (req.HourTo == nil) {
+		return "La franja necesita hour_from y hour_to"
+	}
+	if req.HourFrom != nil && (*req.HourFrom < 0 || *req.HourFrom > 23 || *req.HourTo < 0 || *req.HourTo > 23 || *req.HourFrom == *req.HourTo) {
+		return "hour_from y hour_to deben ser horas distintas entre 0 y 23"
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		return "ends_at debe ser posterior a starts_at"
+	}
+	return ""
+}
+
+// apply copia la petición sobre la regla (PUT reemplaza la regla completa)
+func (req *pointsRuleRequest) apply(r *PointsRule) {
+	r.Name = req.Name
+	r.Kind = req.Kind
+	r.Value = req.Value
+	r.Priority = req.Priority
+	r.Category = req.Category
+	r.VehicleType = req.VehicleType
+	r.ZoneLat, r.ZoneLng, r.ZoneRadiusM = req.ZoneLat, req.ZoneLng, req.ZoneRadiusM
+	r.StartsAt, r.EndsAt = req.StartsAt, req.EndsAt
+	r.HourFrom, r.HourTo = req.HourFrom, req.HourTo
+	r.Condition = req.Condition
+	r.RadiusM = req.RadiusM
+	r.Threshold = req.Threshold
+	r.Active = req.Active == nil || *req.Active
+	r.UpdatedAt = time.Now()
+}
+
+func listPointsRules(c *gin.Context) {
+	var rules []PointsRule
+	query := db.Order("kind, priority DESC, created_at")
+	if c.Query("active") == "true" {
+		query = query.Where("active = ?", true)
+	}
+	if err := query.Find(&rules).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando reglas"})
+		return
+	}
+	c.JSON(200, rules)
+}
+
+func createPointsRule(c *gin.Context) {
+	var req pointsRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	rule := PointsRule{CreatedBy: currentUserID(c), CreatedAt: time.Now()}
+	req.apply(&rule)
+	if err := db.Create(&rule).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error creando regla"})
+		return
+	}
+	c.JSON(201, rule)
+}
+
+func loadPointsRule(c *gin.Context) (*PointsRule, bool) {
+	var rule PointsRule
+	if err := db.First(&rule, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "Regla no encontrada"})
+		} else {
+			c.JSON(500, gin.H{"error": "Error consultando regla"})
+		}
+		return nil, false
+	}
+	return &rule, true
+}
+
+func updatePointsRule(c *gin.Context) {
+	rule, ok := loadPointsRule(c)
+	if !ok {
+		return
+	}
+	var req pointsRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	req.apply(rule)
+	if err := db.Save(rule).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error actualizando regla"})
+		return
+	}
+	c.JSON(200, rule)
+}
+
+func deletePointsRule(c *gin.Context) {
+	rule, ok := loadPointsRule(c)
+	if !ok {
+		return
+	}
+	if err := db.Delete(rule).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error eliminando regla"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Regla eliminada"})
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- CANJES (Redemptions) ---
+
+const (
+	RedemptionRequested = "requested"
+	RedemptionApproved  = "approved"
+	RedemptionPaid      = "paid"
+	RedemptionRejected  = "rejected"
+)
+
+// Tipos de Transaction que escribe el flujo de canje
+const (
+	TxRedeemHold     = "redeem_hold"
+	TxRedeemApproved = "redeem_approved"
+	TxRedeemPaid     = "redeem_paid"
+	TxRedeemRelease  = "redeem_release"
+)
+
+// Redemption (Solicitud de canje de puntos)
+type Redemption struct {
+	ID               string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	UserID           string     `gorm:"index" json:"user_id"`
+	VehicleType      string     `json:"vehicle_type"` // 'moto' o 'car'
+	Amount           float64    `json:"amount"`
+	Status           string     `gorm:"default:'requested'" json:"status"` // 'requested', 'approved', 'paid', 'rejected'
+	PaymentReference string     `json:"payment_reference"`
+	RejectReason     string     `json:"reject_reason"`
+	ReviewedBy       string     `json:"reviewed_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	ApprovedAt       *time.Time `json:"approved_at"`
+	PaidAt           *time.Time `json:"paid_at"`
+}
+
+var (
+	errInsufficientBalance = errors.New("saldo insuficiente")
+	errRedemptionOpen      = errors.New("ya tienes un canje en curso")
+	errRedemptionState     = errors.New("transición de estado inválida")
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// isUUID evita mandar a Postgres ids que fallarían el cast a uuid (500 en vez de 404)
+func isUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// createRedemption retiene el saldo y crea la solicitud en una sola transacción
+func createRedemption(tx *gorm.DB, userID, vehicleType string) (*Redemption, error) {
+	// Bloqueo de la billetera: dos solicitudes simultáneas no pueden gastar el mismo saldo
+	var wallet Wallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&wallet, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	var open int64
+	if err := tx.Model(&Redemption{}).
+		Where("user_id = ? AND status IN ?", userID, []string{RedemptionRequested, RedemptionApproved}).
+		Count(&open).Error; err != nil {
+		return nil, err
+	}
+	if open > 0 {
+		return nil, errRedemptionOpen
+	}
+
+	amount := wallet.Goal
+	balance := wallet.BalanceMoto
+	if vehicleType == "car" {
+		balance = wallet.BalanceCar
+	}
+	if balance < amount {
+		return nil, errInsufficientBalance
+	}
+
+	now := time.Now()
+	r := Redemption{
+		UserID:      userID,
+		VehicleType: vehicleType,
+		Amount:      amount,
+		Status:      RedemptionRequested,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := tx.Create(&r).Error; err != nil {
+		return nil, err
+	}
+	// Saldo disponible -> retenido
+	if err := postRedemption(tx, &r, TxRedeemHold, userAccount(userID, vehicleType), userHeldAccount(userID, vehicleType),
+		"Canje solicitado (saldo retenido)"); err != nil {
+		return nil, err
+	}
+	return &r, tx.Model(&Wallet{}).Where("user_id = ?", userID).Update("status", "pending").Error
+}
+
+// transitionRedemption bloquea el canje, valida el estado actual y aplica 'apply'
+func transitionRedemption(tx *gorm.DB, id, from string, apply func(r *Redemption) error) (*Redemption, error) {
+	if !isUUID(id) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var r Redemption
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&r, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if r.Status != from {
+		return nil, errRedemptionState
+	}
+	if err := apply(&r); err != nil {
+		return nil, err
+	}
+	r.UpdatedAt = time.Now()
+	return &r, tx.Save(&r).Error
+}
+
+// postRedemption registra un paso del canje en el libro mayor
+func postRedemption(tx *gorm.DB, r *Redemption, kind, debit, credit, desc string) error {
+	_, err := postPoints(tx, Posting{
+		UserID:      r.UserID,
+		VehicleType: r.VehicleType,
+		Type:        kind,
+		Description: desc + " #" + r.ID[:8],
+		Debit:       debit,
+		Credit:      credit,
+		Amount:      r.Amount,
+	})
+	return err
+}
+
+// logRedemptionStep registra un paso sin movimiento de puntos (solo historial)
+func logRedemptionStep(tx *gorm.DB, r *Redemption, kind, desc string) error {
+	return tx.Create(&Transaction{
+		UserID:      r.UserID,
+		VehicleType: r.VehicleType,
+		Type:        kind,
+		Description: desc + " #" + r.ID[:8],
+		CreatedAt:   time.Now(),
+	}).Error
+}
+
+// reactivateWallet devuelve la billetera a 'active' al cerrar el canje
+func reactivateWallet(tx *gorm.DB, userID string) error {
+	return tx.Model(&Wallet{}).Where("user_id = ?", userID).Update("status", "active").Error
+}
+
+// redemptionError traduce los errores del flujo a respuestas HTTP
+func redemptionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "Canje no encontrado"})
+	case errors.Is(err, errRedemptionState):
+		c.JSON(409, gin.H{"error": "El canje no está en el estado requerido"})
+	default:
+		c.JSON(500, gin.H{"error": "Error procesando canje"})
+	}
+}
+
+// --- CONTROLADORES ---
+
+func requestRedeem(c *gin.Context) {
+	var req struct {
+		VehicleType string `json:"vehicle_type"` // 'moto' o 'car'
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.VehicleType != "moto" && req.VehicleType != "car") {
+		c.JSON(400, gin.H{"error": "Falta datos (vehicle_type)"})
+		return
+	}
+
+	var r *Redemption
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		r, err = createRedemption(tx, currentUserID(c), req.VehicleType)
+		return err
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "Wallet no encontrada"})
+		return
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(400, gin.H{"error": "Saldo insuficiente en el modo seleccionado"})
+		return
+	case errors.Is(err, errRedemptionOpen):
+		c.JSON(409, gin.H{"error": "Ya tienes un canje en curso"})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": "Error procesando canje"})
+		return
+	}
+
+	log.Printf("💸 Canje %s solicitado por %s (%.0f pts %s)", r.ID, r.UserID, r.Amount, r.VehicleType)
+	c.JSON(200, gin.H{"message": "Solicitud recibida", "new_status": "pending", "redemption": r})
+}
+
+func listMyRedemptions(c *gin.Context) {
+	var list []Redemption
+	if err := db.Order("created_at DESC").Where("user_id = ?", currentUserID(c)).Find(&list).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando canjes"})
+		return
+	}
+	c.JSON(200, list)
+}
+
+func listRedemptions(c *gin.Context) {
+	var list []Redemption
+	query := db.Order("created_at ASC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&list).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando canjes"})
+		return
+	}
+	c.JSON(200, list)
+}
+
+func approveRedemption(c *gin.Context) {
+	var r *Redemption
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		r, err = transitionRedemption(tx, c.Param("id"), RedemptionRequested, func(r *Redemption) error {
+			now := time.Now()
+			r.Status = RedemptionApproved
+			r.ReviewedBy = currentUserID(c)
+			r.ApprovedAt = &now
+			return logRedemptionStep(tx, r, TxRedeemApproved, "Canje aprobado")
+		})
+		return err
+	})
+	if err != nil {
+		redemptionError(c, err)
+		return
+	}
+	log.Printf("💸 Canje %s aprobado por %s", r.ID, currentUserID(c))
+	c.JSON(200, r)
+}
+
+func payRedemption(c *gin.Context) {
+	var req struct {
+		PaymentReference string `json:"payment_reference"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.PaymentReference) == "" {
+		c.JSON(400, gin.H{"error": "Falta payment_reference"})
+		return
+	}
+
+	var r *Redemption
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		r, err = transitionRedemption(tx, c.Param("id"), RedemptionApproved, func(r *Redemption) error {
+			now := time.Now()
+			r.Status = RedemptionPaid
+			r.PaymentReference = strings.TrimSpace(req.PaymentReference)
+			r.PaidAt = &now
+			// Retenido -> pagado (sale del sistema)
+			if err := postRedemption(tx, r, TxRedeemPaid, userHeldAccount(r.UserID, r.VehicleType), AcctPayouts,
+				"Canje pagado (ref. "+r.PaymentReference+")"); err != nil {
+				return err
+			}
+			return reactivateWallet(tx, r.UserID)
+		})
+		return err
+	})
+	if err != nil {
+		redemptionError(c, err)
+		return
+	}
+	log.Printf("💸 Canje %s pagado por %s (ref. %s)", r.ID, currentUserID(c), r.PaymentReference)
+	c.JSON(200, r)
+}
+
+func rejectRedemption(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(400, gin.H{"error": "Falta el motivo del rechazo"})
+		return
+	}
+
+	// Se puede rechazar antes o después de aprobar, nunca tras pagar
+	var r *Redemption
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !isUUID(c.Param("id")) {
+			return gorm.ErrRecordNotFound
+		}
+		var current Redemption
+		if err := tx.First(&current, "id = ?", c.Param("id")).Error; err != nil {
+			return err
+		}
+		from := current.Status
+		if from != RedemptionRequested && from != RedemptionApproved {
+			return errRedemptionState
+		}
+		var err error
+		r, err = transitionRedemption(tx, current.ID, from, func(r *Redemption) error {
+			r.Status = RedemptionRejected
+			r.RejectReason = strings.TrimSpace(req.Reason)
+			r.ReviewedBy = currentUserID(c)
+			// Retenido -> disponible
+			if err := postRedemption(tx, r, TxRedeemRelease, userHeldAccount(r.UserID, r.VehicleType),
+				userAccount(r.UserID, r.VehicleType), "Canje rechazado (saldo devuelto)"); err != nil {
+				return err
+			}
+			return reactivateWallet(tx, r.UserID)
+		})
+		return err
+	})
+	if err != nil {
+		redemptionError(c, err)
+		return
+	}
+	log.Printf("💸 Canje %s rechazado por %s: %s", r.ID, currentUserID(c), r.RejectReason)
+	c.JSON(200, r)
+}
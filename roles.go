@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- ROLES Y PERMISOS ---
+
+const (
+	RoleSuperAdmin   = "super_admin"
+	RoleModerator    = "moderator"
+	RoleStationAdmin = "station_admin"
+	RoleHunter       = "hunter"
+	RoleDriver       = "driver"
+)
+
+var validRoles = map[string]bool{
+	RoleSuperAdmin:   true,
+	RoleModerator:    true,
+	RoleStationAdmin: true,
+	RoleHunter:       true,
+	RoleDriver:       true,
+}
+
+// Permisos que exigen las rutas protegidas
+const (
+	PermReviewVehicles    = "vehicles:review"
+	PermViewStations      = "stations:view"
+	PermSetupB2B          = "b2b:setup"
+	PermManageRoles       = "roles:manage"
+	PermManageHunters     = "hunters:manage"
+	PermRotatePIN         = "stations:rotate_pin"
+	PermManageOffers      = "offers:manage"
+	PermManageRedemptions = "redemptions:manage" // Solo super_admin (mueve dinero)
+	PermModerateLocations = "locations:moderate"
+	PermMergeLocations    = "locations:merge"  // Solo super_admin (re-vincula estaciones y puede mover puntos)
+	PermImportLocations   = "locations:import" // Solo super_admin (carga masiva)
+	PermExportData        = "data:export"      // Solo super_admin (saldos y datos personales)
+	PermManagePoints      = "points:manage"    // Solo super_admin (define cuánto se emite)
+)
+
+// Matriz rol -> permisos (super_admin lo tiene todo)
+var rolePermissions = map[string]map[string]bool{
+	RoleModerator: {
+		PermReviewVehicles:    true,
+		PermViewStations:      true,
+		PermManageHunters:     true,
+		PermRotatePIN:         true,
+		PermManageOffers:      true,
+		PermModerateLocations: true,
+	},
+	RoleStationAdmin: {},
+	RoleHunter:       {},
+	RoleDriver:       {},
+}
+
+// UserRole (Fuente de verdad de autorización; reemplaza a Vehicle.Role)
+type UserRole struct {
+	ID        string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	UserID    string    `gorm:"uniqueIndex:idx_user_role_scope" json:"user_id"`
+	Role      string    `gorm:"uniqueIndex:idx_user_role_scope" json:"role"`
+	StationID string    `gorm:"uniqueIndex:idx_user_role_scope;default:''" json:"station_id"` // Solo para station_admin
+	GrantedBy string    `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const ctxUserRoles = "auth_roles"
+
+func loadUserRoles(tx *gorm.DB, userID string) ([]UserRole, error) {
+	var roles []UserRole
+	err := tx.Where("user_id = ?", userID).Find(&roles).Error
+	return roles, err
+}
+
+func hasPermission(roles []UserRole, perm string) bool {
+	for _, r := range roles {
+		if r.Role == RoleSuperAdmin || rolePermissions[r.Role][perm] {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRole(roles []UserRole, role string) bool {
+	for _, r := range roles {
+		if r.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// stationAdminOf indica si el usuario administra la estación dada
+func stationAdminOf(roles []UserRole, stationID string) bool {
+	for _, r := range roles {
+		if r.Role == RoleStationAdmin && r.StationID == stationID {
+			return true
+		}
+	}
+	return false
+}
+
+// grantRole es idempotente: si el rol ya existe no hace nada
+func grantRole(tx *gorm.DB, userID, role, stationID, grantedBy string) error {
+	ur := UserRole{UserID: userID, Role: role, StationID: stationID, GrantedBy: grantedBy, CreatedAt: time.Now()}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ur).Error
+}
+
+var errLastSuperAdmin = errors.New("no puede quedar el sistema sin super_admin")
+
+func revokeRole(tx *gorm.DB, userID, role, stationID string) (int64, error) {
+	q := tx.Where("user_id = ? AND role = ?", userID, role)
+	if stationID != "" {
+		q = q.Where("station_id = ?", stationID)
+	}
+	res := q.Delete(&UserRole{})
+	return res.RowsAffected, res.Error
+}
+
+// seedSuperAdmins garantiza que los UIDs de SUPER_ADMIN_UIDS tengan rol super_admin
+func seedSuperAdmins(tx *gorm.DB, csv string) {
+	for _, uid := range strings.Split(csv, ",") {
+		uid = strings.TrimSpace(uid)
+		if uid == "" {
+			continue
+		}
+		if err := grantRole(tx, uid, RoleSuperAdmin, "", "bootstrap"); err != nil {
+			log.Printf("⚠️ Error sembrando super_admin %s: %v", uid, err)
+		}
+	}
+}
+
+// --- MIDDLEWARE ---
+
+// RequirePermission carga los roles del usuario autenticado y exige el permiso indicado
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles, err := loadUserRoles(db, currentUserID(c))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error consultando roles"})
+			return
+		}
+		if !hasPermission(roles, perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "No tienes permisos para esta acción"})
+			return
+		}
+		c.Set(ctxUserRoles, roles)
+		c.Next()
+	}
+}
+
+// --- CONTROLADORES ---
+
+func listUserRoles(c *gin.Context) {
+	roles, err := loadUserRoles(db, c.Param("user_id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error consultando roles"})
+		return
+	}
+	c.JSON(200, roles)
+}
+
+type roleRequest struct {
+	UserID    string `json:"user_id" binding:"required"`
+	Role      string `json:"role" binding:"required"`
+	StationID string `json:"station_id"`
+}
+
+func (req roleRequest) validate() string {
+	if !validRoles[req.Role] {
+		return "Rol inválido: " + req.Role
+	}
+	if req.Role == RoleStationAdmin && req.StationID == "" {
+		return "station_admin requiere station_id"
+	}
+	if req.Role != RoleStationAdmin && req.StationID != "" {
+		return "station_id solo aplica a station_admin"
+	}
+	return ""
+}
+
+func grantRoleHandler(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Faltan datos (user_id/role)"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
+	if err := grantRole(db, req.UserID, req.Role, req.StationID, currentUserID(c)); err != nil {
+		c.JSON(500, gin.H{"error": "Error asignando rol"})
+		return
+	}
+	log.Printf("🔐 Rol %s otorgado a %s por %s", req.Role, req.UserID, currentUserID(c))
+	c.JSON(200, gin.H{"message": "Rol asignado"})
+}
+
+func revokeRoleHandler(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Faltan datos (user_id/role)"})
+		return
+	}
+	if !validRoles[req.Role] {
+		c.JSON(400, gin.H{"error": "Rol inválido: " + req.Role})
+		return
+	}
+	// Un super_admin no puede quitarse el rol a sí mismo
+	if req.Role == RoleSuperAdmin && req.UserID == currentUserID(c) {
+		c.JSON(400, gin.H{"error": "No puedes revocar tu propio rol de super_admin"})
+		return
+	}
+
+	var n int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if req.Role == RoleSuperAdmin {
+			// Bloqueamos las filas super_admin para serializar revocaciones concurrentes
+			var admins []UserRole
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("role = ?", RoleSuperAdmin).Find(&admins).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if n, err = revokeRole(tx, req.UserID, req.Role, req.StationID); err != nil || n == 0 {
+			return err
+		}
+
+		// Evitar que el sistema se quede sin ningún super_admin
+		if req.Role == RoleSuperAdmin {
+			var remaining int64
+			if err := tx.Model(&UserRole{}).Where("role = ?", RoleSuperAdmin).Count(&remaining).Error; err != nil {
+				return err
+			}
+			if remaining == 0 {
+				return errLastSuperAdmin
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errLastSuperAdmin) {
+		c.JSON(409, gin.H{"error": "No se puede revocar el último super_admin"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error revocando rol"})
+		return
+	}
+	if n == 0 {
+		c.JSON(404, gin.H{"error": "El usuario no tiene ese rol"})
+		return
+	}
+	log.Printf("🔐 Rol %s revocado a %s por %s", req.Role, req.UserID, currentUserID(c))
+	c.JSON(200, gin.H{"message": "Rol revocado"})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// --- TAREAS PROGRAMADAS ---
+
+// startJob ejecuta 'fn' al arrancar y luego cada 'interval' hasta que ctx se cancele.
+// Un pánico en una ejecución se registra y no mata al proceso.
+func startJob(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	run := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("❌ [job:%s] pánico: %v", name, r)
+			}
+		}()
+		if err := fn(ctx); err != nil {
+			log.Printf("❌ [job:%s] %v", name, err)
+		}
+	}
+
+	go func() {
+		run()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+	log.Printf("⏱️ Job %s programado cada %s", name, interval)
+}
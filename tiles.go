@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- TESELAS VECTORIALES (Mapbox Vector Tiles) ---
+
+const (
+	tileMaxZoom = 22
+	tileExtent  = 4096
+	tileBuffer  = 64
+	tileMaxAge  = 60 // Segundos: las ofertas flash cambian rápido
+)
+
+// tileQuery una capa por categoría y estado ("mechanic:approved", "food:flash").
+// Las capas MVT se pueden concatenar: cada ST_AsMVT por grupo aporta su capa al mismo tile.
+const tileQuery = `
+	WITH env AS (
+		SELECT ST_TileEnvelope(?, ?, ?) AS merc
+	), bounds AS (
+		SELECT merc, ST_Transform(merc, 4326)::geography AS geo FROM env
+	), features AS (
+		SELECT
+			'offer' AS source,
+			o.id::text AS id,
+			o.title,
+			o.category::text AS category, -- Cast para el Enum de categoría
+			o.status::text AS status,
+			o.price,
+			GREATEST(EXTRACT(EPOCH FROM o.ends_at - NOW()), 0)::bigint AS remaining_seconds,
+			ST_AsMVTGeom(ST_Transform(o.location::geometry, 3857), b.merc, ?, ?, true) AS geom
+		FROM offers o, bounds b
+		WHERE ST_Intersects(o.location, b.geo)
+		AND o.status::text NOT IN ('paused', 'scheduled', 'expired')
+		AND (o.ends_at IS NULL OR o.ends_at > NOW())
+		UNION ALL
+		SELECT
+			'location',
+			l.id::text,
+			l.shop_name,
+			l.category,
+			CASE
+				WHEN l.category IN ('station_moto', 'station_car') AND (l.status IS NULL OR l.status = 'pending') THEN 'shadow'
+				WHEN l.status IS NULL OR l.status = '' THEN 'approved'
+				ELSE l.status
+			END,
+			NULL::float8,
+			NULL::bigint,
+			ST_AsMVTGeom(ST_Transform(l.geom::geometry, 3857), b.merc, ?, ?, true)
+		FROM locations l, bounds b
+		WHERE ST_Intersects(l.geom, b.geo)
+		AND l.status IS DISTINCT FROM 'rejected'
+		AND l.status IS DISTINCT FROM 'merged'
+	), layers AS (
+		SELECT ST_AsMVT(f, f.category || ':' || f.status, ?, 'geom') AS mvt
+		FROM features f
+		WHERE f.geom IS NOT NULL
+		GROUP BY f.category, f.status
+	)
+	SELECT COALESCE(string_agg(mvt, ''::bytea), ''::bytea) FROM layers`
+
+// parseTileCoords valida z/x/y (y debe terminar en .mvt)
+func parseTileCoords(c *gin.Context) (z, x, y int, ok bool) {
+	yStr, hasExt := strings.CutSuffix(c.Param("y"), ".mvt")
+	if !hasExt {
+		return 0, 0, 0, false
+	}
+	var err1, err2, err3 error
+	z, err1 = strconv.Atoi(c.Param("z"))
+	x, err2 = strconv.Atoi(c.Param("x"))
+	y, err3 = strconv.Atoi(yStr)
+	if err1 != nil || err2 != nil || err3 != nil || z < 0 || z > tileMaxZoom {
+		return 0, 0, 0, false
+	}
+	n := 1 << z
+	return z, x, y, x >= 0 && x < n && y >= 0 && y < n
+}
+
+// getTile sirve /api/tiles/:z/:x/:y.mvt (público, igual que /api/offers)
+func getTile(c *gin.Context) {
+	z, x, y, ok := parseTileCoords(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "Tile inválido (usa /api/tiles/{z}/{x}/{y}.mvt)"})
+		return
+	}
+
+	var tile []byte
+	if err := db.WithContext(c.Request.Context()).Raw(tileQuery,
+		z, x, y,
+		tileExtent, tileBuffer,
+		tileExtent, tileBuffer,
+		tileExtent,
+	).Row().Scan(&tile); err != nil {
+		log.Printf("❌ Error generando tile %d/%d/%d: %v", z, x, y, err)
+		c.JSON(500, gin.H{"error": "Error generando tile"})
+		return
+	}
+
+	sum := sha256.Sum256(tile)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(tileMaxAge))
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(304)
+		return
+	}
+	if len(tile) == 0 {
+		c.Status(204) // Tile vacío: el cliente no dibuja nada
+		return
+	}
+	c.Data(200, "application/vnd.mapbox-vector-tile", tile)
+}